@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/checkspeed/sc-backend/internal/auth"
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/db"
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+// runCommand runs the maintenance command in args instead of the server, e.g.
+//
+//	sc-backend create-api-key -name "Acme ISP" -quota 5000
+//	sc-backend set-role -email admin@example.com -role admin
+func runCommand(ctx context.Context, cfg config.Config, store db.Store, args []string) error {
+	switch args[0] {
+	case "create-api-key":
+		return createAPIKey(ctx, cfg, store, args[1:])
+	case "set-role":
+		return setRole(ctx, store, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// createAPIKey creates a partner API key and prints it, the key can not be retrieved later
+func createAPIKey(ctx context.Context, cfg config.Config, store db.Store, args []string) error {
+	flags := flag.NewFlagSet("create-api-key", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the partner the key is for")
+	quota := flags.Int("quota", cfg.PartnerDailyQuota, "requests allowed per day")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	*name = strings.TrimSpace(*name)
+	if *name == "" {
+		return errors.New("-name is required")
+	}
+	if *quota <= 0 {
+		return errors.New("-quota must be a positive number")
+	}
+
+	repo, err := db.NewAPIKeysRepo(store)
+	if err != nil {
+		return err
+	}
+	apiKey, err := auth.NewAPIKey(*name, *quota)
+	if err != nil {
+		return err
+	}
+	if err := repo.Create(ctx, apiKey.APIKey); err != nil {
+		return err
+	}
+
+	fmt.Printf("created API key %s for %s with a daily quota of %d\n%s\n", apiKey.ID, apiKey.Name, apiKey.DailyQuota, apiKey.Key)
+	return nil
+}
+
+// setRole changes the role of a user, it applies to the tokens issued from the next login
+func setRole(ctx context.Context, store db.Store, args []string) error {
+	flags := flag.NewFlagSet("set-role", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the user")
+	role := flags.String("role", models.RoleAdmin, "role to give the user")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *role != models.RoleUser && *role != models.RoleAdmin {
+		return fmt.Errorf("-role must be %s or %s", models.RoleUser, models.RoleAdmin)
+	}
+
+	repo, err := db.NewUsersRepo(store)
+	if err != nil {
+		return err
+	}
+	user, err := repo.GetByEmail(ctx, strings.TrimSpace(*email))
+	if err != nil {
+		return fmt.Errorf("find user %q: %w", *email, err)
+	}
+	if err := repo.SetRole(ctx, user.ID, *role); err != nil {
+		return err
+	}
+
+	fmt.Printf("user %s (%s) is now %s\n", user.Username, user.Email, *role)
+	return nil
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/google/uuid"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+// apiKeyPrefix marks partner API keys so they are easy to recognise, e.g. in leaked secrets scans
+const apiKeyPrefix = "sck_"
+
+// NewAPIKey generates a partner API key. The returned key is only shown once, the hash
+// stored in its place is enough to authenticate it.
+func NewAPIKey(name string, dailyQuota int) (models.CreatedAPIKey, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(b)
+
+	return models.CreatedAPIKey{
+		APIKey: models.APIKey{
+			ID:         uuid.NewString(),
+			Name:       name,
+			KeyPrefix:  key[:len(apiKeyPrefix)+8],
+			KeyHash:    HashAPIKey(key),
+			DailyQuota: dailyQuota,
+		},
+		Key: key,
+	}, nil
+}
+
+// HashAPIKey returns the hex encoded sha256 hash of key. API keys are random and long, so a
+// fast hash is enough to keep them from being usable if the table leaks.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
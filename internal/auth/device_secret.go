@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// deviceSecretPrefix marks device secrets so they are easy to recognise, like API keys
+const deviceSecretPrefix = "scd_"
+
+// NewDeviceSecret generates the secret proving that a client holds a device, required to link the
+// device to a user. The secret is only returned when the device is created, its hash is stored in
+// its place.
+func NewDeviceSecret() (secret, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = deviceSecretPrefix + hex.EncodeToString(b)
+	return secret, HashDeviceSecret(secret), nil
+}
+
+// HashDeviceSecret returns the hex encoded sha256 hash of secret, random and long like an API key
+func HashDeviceSecret(secret string) string {
+	return HashAPIKey(secret)
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+)
+
+const issuer = "sc-backend"
+
+var (
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrMissingSecret = errors.New("JWT_SECRET is not set")
+)
+
+// Claims are the claims of an access token, the subject is the user id
+type Claims struct {
+	jwt.RegisteredClaims
+	// Role of the user when the token was issued, role changes apply to new tokens
+	Role string `json:"role,omitempty"`
+}
+
+// TokenManager issues and verifies HMAC signed access tokens
+type TokenManager struct {
+	secret []byte
+	// verifyKeys holds the current secret followed by the previous ones
+	verifyKeys [][]byte
+	ttl        time.Duration
+	now        func() time.Time
+}
+
+// NewTokenManager creates a TokenManager from the JWT settings of cfg, it returns ErrMissingSecret
+// when no secret is configured
+func NewTokenManager(cfg config.Config) (*TokenManager, error) {
+	if cfg.JWTSecret == "" {
+		return nil, ErrMissingSecret
+	}
+	secret := []byte(cfg.JWTSecret)
+
+	tm := &TokenManager{
+		secret:     secret,
+		verifyKeys: [][]byte{secret},
+		ttl:        cfg.JWTTTL,
+		now:        time.Now,
+	}
+	for _, s := range cfg.JWTPreviousSecrets {
+		tm.verifyKeys = append(tm.verifyKeys, []byte(s))
+	}
+	return tm, nil
+}
+
+// Issue returns a signed token for userID with role and its expiry time
+func (tm *TokenManager) Issue(userID, role string) (string, time.Time, error) {
+	now := tm.now()
+	expiresAt := now.Add(tm.ttl)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Role: role,
+	})
+
+	signed, err := token.SignedString(tm.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// Parse verifies token against the current and previous secrets and returns its claims
+func (tm *TokenManager) Parse(token string) (*Claims, error) {
+	for _, key := range tm.verifyKeys {
+		var claims Claims
+		_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+			return key, nil
+		},
+			jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+			jwt.WithIssuer(issuer),
+			jwt.WithExpirationRequired(),
+			jwt.WithTimeFunc(tm.now),
+		)
+		if err == nil && claims.Subject != "" {
+			return &claims, nil
+		}
+		if err != nil && !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			// only a signature mismatch can be fixed by trying another key
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+	}
+	return nil, ErrInvalidToken
+}
@@ -0,0 +1,68 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/auth"
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenManager(t *testing.T) {
+	cfg := config.Config{JWTSecret: "current-secret", JWTTTL: time.Hour}
+	tokens, err := auth.NewTokenManager(cfg)
+	require.NoError(t, err)
+
+	t.Run("issued token is valid", func(t *testing.T) {
+		token, expiresAt, err := tokens.Issue("user-1", models.RoleUser)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+
+		claims, err := tokens.Parse(token)
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", claims.Subject)
+	})
+
+	t.Run("tokens signed with a previous secret are accepted", func(t *testing.T) {
+		old, err := auth.NewTokenManager(config.Config{JWTSecret: "old-secret", JWTTTL: time.Hour})
+		require.NoError(t, err)
+		token, _, err := old.Issue("user-1", models.RoleUser)
+		require.NoError(t, err)
+
+		_, err = tokens.Parse(token)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+		rotated, err := auth.NewTokenManager(config.Config{
+			JWTSecret:          "current-secret",
+			JWTPreviousSecrets: []string{"old-secret"},
+			JWTTTL:             time.Hour,
+		})
+		require.NoError(t, err)
+		claims, err := rotated.Parse(token)
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", claims.Subject)
+	})
+
+	t.Run("expired token is rejected", func(t *testing.T) {
+		expired, err := auth.NewTokenManager(config.Config{JWTSecret: "current-secret", JWTTTL: -time.Minute})
+		require.NoError(t, err)
+		token, _, err := expired.Issue("user-1", models.RoleUser)
+		require.NoError(t, err)
+
+		_, err = tokens.Parse(token)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("malformed token is rejected", func(t *testing.T) {
+		_, err := tokens.Parse("not-a-token")
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("missing secret is rejected", func(t *testing.T) {
+		_, err := auth.NewTokenManager(config.Config{JWTTTL: time.Hour})
+		assert.ErrorIs(t, err, auth.ErrMissingSecret)
+	})
+}
@@ -1,14 +1,38 @@
 package config
 
 import (
+	"log/slog"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 const (
-	defaultPort  = "8080"
-	defaultDbUrl = "postgresql://localhost:5432"
+	defaultPort           = "8080"
+	defaultMetricsPort    = "9090"
+	defaultDbUrl          = "postgresql://localhost:5432"
+	defaultTestTimeMaxAge = 30 * 24 * time.Hour
+	defaultJWTTTL         = 24 * time.Hour
+
+	defaultPartnerDailyQuota = 10000
+	defaultShutdownTimeout   = 30 * time.Second
+
+	defaultGeoIPReloadInterval = time.Minute
+
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+
+	GeoProviderIPGeolocation = "ipgeolocation"
+	GeoProviderGeoJS         = "geojs"
+	GeoProviderMMDB          = "mmdb"
 )
 
 // Config contain all the config that this application needs
@@ -16,6 +40,58 @@ type Config struct {
 	Port      string
 	GeoAPIKey string
 	DBURL     string
+
+	// MetricsPort serves /metrics apart from the api, so it can be kept private
+	MetricsPort string
+
+	// GeoProviders are the geolocation providers asked in turn to locate an IP address
+	GeoProviders []string
+	// GeoIPDBPath is the local MaxMind or DB-IP city database (.mmdb) used by the mmdb provider
+	GeoIPDBPath string
+	// GeoIPASNDBPath is an optional local ASN or ISP database (.mmdb) adding the network to its lookups
+	GeoIPASNDBPath string
+	// GeoIPReloadInterval is how often the local databases are checked for changes
+	GeoIPReloadInterval time.Duration
+	// GeoCache is the cache in front of the geolocation providers
+	GeoCache GeoCache
+
+	// TestTimeMaxAge is how old the test_time of a submitted result may be, 0 means no limit
+	TestTimeMaxAge time.Duration
+
+	// JWTSecret signs the access tokens issued on login
+	JWTSecret string
+	// JWTPreviousSecrets are still accepted when verifying tokens, so the secret can be rotated
+	// without logging everyone out
+	JWTPreviousSecrets []string
+	// JWTTTL is how long an access token is valid
+	JWTTTL time.Duration
+
+	// PartnerDailyQuota is the daily quota of partner API keys created without one
+	PartnerDailyQuota int
+
+	RateLimits RateLimits
+	// TrustedProxies are the networks of the proxies whose X-Forwarded-For header gives the client
+	// address, requests from anywhere else are attributed to their peer address
+	TrustedProxies []netip.Prefix
+
+	// ShutdownTimeout is how long in flight requests are given to finish on shutdown
+	ShutdownTimeout time.Duration
+	// ShutdownDelay is how long readiness reports failing before the server stops accepting
+	// requests, so the orchestrator can route traffic away first
+	ShutdownDelay time.Duration
+
+	// ReadinessGeoProbe adds a request to the geolocation api to the readiness checks
+	ReadinessGeoProbe bool
+
+	// TracingExporter is where spans are sent: "otlp", "stdout" or "none"
+	TracingExporter string
+	// TracingSampleRatio is the share of traces started here that are sampled, from 0 to 1
+	TracingSampleRatio float64
+
+	// LogLevel is the minimum level logged: "debug", "info", "warn" or "error"
+	LogLevel string
+	// LogFormat is "json" or "text"
+	LogFormat string
 }
 
 // LoadConfig loads Config from the environment and returns it
@@ -34,6 +110,11 @@ func LoadConfig(filename ...string) Config {
 	}
 	config.Port = port
 
+	config.MetricsPort = defaultMetricsPort
+	if metricsPort, ok := os.LookupEnv("METRICS_PORT"); ok && metricsPort != "" {
+		config.MetricsPort = metricsPort
+	}
+
 	dbUrl, ok := os.LookupEnv("DB_URL")
 	if !ok {
 		dbUrl = defaultDbUrl
@@ -46,5 +127,121 @@ func LoadConfig(filename ...string) Config {
 	}
 	config.GeoAPIKey = geoAPIKey
 
+	config.GeoIPDBPath = os.Getenv("GEOIP_DB_PATH")
+	config.GeoIPASNDBPath = os.Getenv("GEOIP_ASN_DB_PATH")
+	config.GeoIPReloadInterval = defaultGeoIPReloadInterval
+	if interval, ok := os.LookupEnv("GEOIP_RELOAD_INTERVAL"); ok {
+		if d, err := time.ParseDuration(interval); err == nil && d > 0 {
+			config.GeoIPReloadInterval = d
+		}
+	}
+
+	config.GeoProviders = []string{GeoProviderIPGeolocation, GeoProviderGeoJS}
+	if config.GeoIPDBPath != "" {
+		// the local database answers first, the apis are only asked for what it does not know
+		config.GeoProviders = append([]string{GeoProviderMMDB}, config.GeoProviders...)
+	}
+	if providers, ok := os.LookupEnv("GEO_PROVIDERS"); ok {
+		config.GeoProviders = nil
+		for _, provider := range strings.Split(providers, ",") {
+			if provider = strings.ToLower(strings.TrimSpace(provider)); provider != "" {
+				config.GeoProviders = append(config.GeoProviders, provider)
+			}
+		}
+	}
+
+	config.GeoCache = loadGeoCache()
+
+	config.TestTimeMaxAge = defaultTestTimeMaxAge
+	if maxAge, ok := os.LookupEnv("TEST_TIME_MAX_AGE"); ok {
+		if d, err := time.ParseDuration(maxAge); err == nil {
+			config.TestTimeMaxAge = d
+		}
+	}
+
+	config.JWTSecret = os.Getenv("JWT_SECRET")
+	for _, secret := range strings.Split(os.Getenv("JWT_PREVIOUS_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			config.JWTPreviousSecrets = append(config.JWTPreviousSecrets, secret)
+		}
+	}
+
+	config.JWTTTL = defaultJWTTTL
+	if ttl, ok := os.LookupEnv("JWT_TTL"); ok {
+		if d, err := time.ParseDuration(ttl); err == nil && d > 0 {
+			config.JWTTTL = d
+		}
+	}
+
+	config.PartnerDailyQuota = defaultPartnerDailyQuota
+	if quota, ok := os.LookupEnv("PARTNER_DAILY_QUOTA"); ok {
+		if n, err := strconv.Atoi(quota); err == nil && n > 0 {
+			config.PartnerDailyQuota = n
+		}
+	}
+
+	config.RateLimits = loadRateLimits()
+	config.TrustedProxies = loadPrefixes("TRUSTED_PROXIES")
+
+	config.ShutdownTimeout = defaultShutdownTimeout
+	if timeout, ok := os.LookupEnv("SHUTDOWN_TIMEOUT"); ok {
+		if d, err := time.ParseDuration(timeout); err == nil && d > 0 {
+			config.ShutdownTimeout = d
+		} else {
+			slog.Warn("ignoring SHUTDOWN_TIMEOUT: must be a positive duration", "value", timeout)
+		}
+	}
+
+	if delay, ok := os.LookupEnv("SHUTDOWN_DELAY"); ok {
+		if d, err := time.ParseDuration(delay); err == nil && d >= 0 {
+			config.ShutdownDelay = d
+		} else {
+			slog.Warn("ignoring SHUTDOWN_DELAY: must be a duration of 0 or more", "value", delay)
+		}
+	}
+
+	if probe, ok := os.LookupEnv("READINESS_GEO_PROBE"); ok {
+		config.ReadinessGeoProbe, _ = strconv.ParseBool(probe)
+	}
+
+	config.TracingExporter = TracingExporterNone
+	switch exporter := strings.ToLower(os.Getenv("TRACING_EXPORTER")); exporter {
+	case TracingExporterStdout, TracingExporterOTLP:
+		config.TracingExporter = exporter
+	}
+	config.TracingSampleRatio = 1
+	if ratio, ok := os.LookupEnv("TRACING_SAMPLE_RATIO"); ok {
+		if r, err := strconv.ParseFloat(ratio, 64); err == nil && r >= 0 && r <= 1 {
+			config.TracingSampleRatio = r
+		}
+	}
+
+	config.LogLevel = "info"
+	if level, ok := os.LookupEnv("LOG_LEVEL"); ok && level != "" {
+		config.LogLevel = strings.ToLower(level)
+	}
+	config.LogFormat = LogFormatJSON
+	if strings.ToLower(os.Getenv("LOG_FORMAT")) == LogFormatText {
+		config.LogFormat = LogFormatText
+	}
+
 	return config
 }
+
+// loadPrefixes reads the comma separated IPs and CIDRs of the env var name, invalid entries are
+// logged and skipped
+func loadPrefixes(name string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(os.Getenv(name), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		prefix, err := ParsePrefix(entry)
+		if err != nil {
+			slog.Warn("ignoring "+name+" entry", "entry", entry, "error", err)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// GeoCache configures the cache in front of the geolocation providers
+type GeoCache struct {
+	// TTL is how long a located address is cached, 0 disables the cache
+	TTL time.Duration
+	// NotFoundTTL is how long an address no provider could locate is cached, in memory only
+	NotFoundTTL time.Duration
+	// MaxEntries bounds the addresses cached in memory, the least recently used are evicted first
+	MaxEntries int
+	// IPv4PrefixLen and IPv6PrefixLen are the lengths of the prefixes sharing a cache entry, e.g.
+	// 24 caches an IPv4 /24 network once. Addresses of a prefix usually share their location.
+	IPv4PrefixLen int
+	IPv6PrefixLen int
+
+	// Backend is GeoCacheBackendMemory, or GeoCacheBackendPostgres to also keep the located
+	// addresses in a table shared by all instances and surviving restarts
+	Backend string
+	// CleanupInterval is how often expired entries are removed
+	CleanupInterval time.Duration
+}
+
+// Geolocation cache backends
+const (
+	GeoCacheBackendMemory   = "memory"
+	GeoCacheBackendPostgres = "postgres"
+)
+
+var defaultGeoCache = GeoCache{
+	TTL:           24 * time.Hour,
+	NotFoundTTL:   time.Hour,
+	MaxEntries:    100000,
+	IPv4PrefixLen: 32,
+	IPv6PrefixLen: 64,
+
+	CleanupInterval: 10 * time.Minute,
+}
+
+// loadGeoCache reads the geolocation cache config from GEO_CACHE_TTL, GEO_CACHE_NOT_FOUND_TTL,
+// GEO_CACHE_MAX_ENTRIES, GEO_CACHE_IPV4_PREFIX, GEO_CACHE_IPV6_PREFIX, GEO_CACHE_BACKEND and
+// GEO_CACHE_CLEANUP_INTERVAL. Invalid values are logged and the defaults kept.
+func loadGeoCache() GeoCache {
+	cache := defaultGeoCache
+	cache.Backend = GeoCacheBackendMemory
+	switch backend := os.Getenv("GEO_CACHE_BACKEND"); backend {
+	case "", GeoCacheBackendMemory:
+	case GeoCacheBackendPostgres:
+		cache.Backend = backend
+	default:
+		slog.Warn("ignoring GEO_CACHE_BACKEND: unknown backend", "backend", backend)
+	}
+
+	cache.TTL = loadDuration("GEO_CACHE_TTL", cache.TTL, 0)
+	cache.NotFoundTTL = loadDuration("GEO_CACHE_NOT_FOUND_TTL", cache.NotFoundTTL, 0)
+	cache.CleanupInterval = loadDuration("GEO_CACHE_CLEANUP_INTERVAL", cache.CleanupInterval, 1)
+
+	if value, ok := os.LookupEnv("GEO_CACHE_MAX_ENTRIES"); ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			cache.MaxEntries = n
+		} else {
+			slog.Warn("ignoring GEO_CACHE_MAX_ENTRIES: must be a number")
+		}
+	}
+	cache.IPv4PrefixLen = loadPrefixLen("GEO_CACHE_IPV4_PREFIX", cache.IPv4PrefixLen, 32)
+	cache.IPv6PrefixLen = loadPrefixLen("GEO_CACHE_IPV6_PREFIX", cache.IPv6PrefixLen, 128)
+
+	return cache
+}
+
+// loadDuration reads the duration in name, which must be at least minimum
+func loadDuration(name string, def, minimum time.Duration) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < minimum {
+		slog.Warn("ignoring "+name+": invalid duration", "value", value)
+		return def
+	}
+	return d
+}
+
+// loadPrefixLen reads the prefix length in name, from 1 to bits
+func loadPrefixLen(name string, def, bits int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > bits {
+		slog.Warn("ignoring "+name+": invalid prefix length", "value", value, "max", bits)
+		return def
+	}
+	return n
+}
@@ -0,0 +1,41 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigGeoCache(t *testing.T) {
+	cfg := config.LoadConfig("testdata/missing.env")
+	assert.Equal(t, config.GeoCache{
+		TTL:             24 * time.Hour,
+		NotFoundTTL:     time.Hour,
+		MaxEntries:      100000,
+		IPv4PrefixLen:   32,
+		IPv6PrefixLen:   64,
+		Backend:         config.GeoCacheBackendMemory,
+		CleanupInterval: 10 * time.Minute,
+	}, cfg.GeoCache)
+
+	t.Setenv("GEO_CACHE_TTL", "0s")
+	t.Setenv("GEO_CACHE_NOT_FOUND_TTL", "-1m")
+	t.Setenv("GEO_CACHE_MAX_ENTRIES", "500")
+	t.Setenv("GEO_CACHE_IPV4_PREFIX", "24")
+	t.Setenv("GEO_CACHE_IPV6_PREFIX", "129")
+	t.Setenv("GEO_CACHE_BACKEND", "postgres")
+	t.Setenv("GEO_CACHE_CLEANUP_INTERVAL", "0s")
+
+	cfg = config.LoadConfig("testdata/missing.env")
+	assert.Equal(t, config.GeoCache{
+		TTL:             0,
+		NotFoundTTL:     time.Hour,
+		MaxEntries:      500,
+		IPv4PrefixLen:   24,
+		IPv6PrefixLen:   64,
+		Backend:         config.GeoCacheBackendPostgres,
+		CleanupInterval: 10 * time.Minute,
+	}, cfg.GeoCache)
+}
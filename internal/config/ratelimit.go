@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit allows Requests per Period to a client, in bursts of up to Burst requests
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// Limit returns the rate at which a client's allowance refills, Requests <= 0 means no limit
+func (rl RateLimit) Limit() rate.Limit {
+	if rl.Requests <= 0 || rl.Period <= 0 {
+		return rate.Inf
+	}
+	return rate.Every(rl.Period / time.Duration(rl.Requests))
+}
+
+// RateLimits holds the rate limit of each rate limited route group
+type RateLimits struct {
+	Submit   RateLimit // speed test result submissions
+	Auth     RateLimit // user registration and login
+	Feedback RateLimit // feedback, stored in Notion
+	Network  RateLimit // routes calling the geolocation APIs
+
+	// Allowlist holds the networks of internal clients, which are never rate limited
+	Allowlist []netip.Prefix
+
+	// Backend keeps the limits, RateLimitBackendMemory per instance or RateLimitBackendPostgres
+	// shared by all instances
+	Backend string
+	// MaxEntries bounds the clients tracked in memory per route group, the least recently seen
+	// are evicted first
+	MaxEntries int
+	// CleanupInterval is how often the limiters of clients that went quiet are removed
+	CleanupInterval time.Duration
+}
+
+// Rate limit backends
+const (
+	RateLimitBackendMemory   = "memory"
+	RateLimitBackendPostgres = "postgres"
+)
+
+var defaultRateLimits = RateLimits{
+	Submit:   RateLimit{Requests: 1, Period: time.Minute, Burst: 1},
+	Auth:     RateLimit{Requests: 10, Period: time.Minute, Burst: 5},
+	Feedback: RateLimit{Requests: 5, Period: time.Hour, Burst: 2},
+	Network:  RateLimit{Requests: 30, Period: time.Minute, Burst: 10},
+
+	MaxEntries:      100000,
+	CleanupInterval: time.Minute,
+}
+
+// loadRateLimits reads the rate limits from RATE_LIMIT_<GROUP> as "<requests>/<period>",
+// e.g. "10/1m", RATE_LIMIT_<GROUP>_BURST, the comma separated IPs and CIDRs of
+// RATE_LIMIT_ALLOWLIST, RATE_LIMIT_BACKEND, RATE_LIMIT_MAX_ENTRIES and
+// RATE_LIMIT_CLEANUP_INTERVAL. Invalid values are logged and the defaults kept.
+func loadRateLimits() RateLimits {
+	limits := defaultRateLimits
+	limits.Backend = RateLimitBackendMemory
+	switch backend := os.Getenv("RATE_LIMIT_BACKEND"); backend {
+	case "", RateLimitBackendMemory:
+	case RateLimitBackendPostgres:
+		limits.Backend = backend
+	default:
+		slog.Warn("ignoring RATE_LIMIT_BACKEND: unknown backend", "backend", backend)
+	}
+
+	limits.Submit = loadRateLimit("SUBMIT", limits.Submit)
+	limits.Auth = loadRateLimit("AUTH", limits.Auth)
+	limits.Feedback = loadRateLimit("FEEDBACK", limits.Feedback)
+	limits.Network = loadRateLimit("NETWORK", limits.Network)
+
+	if value, ok := os.LookupEnv("RATE_LIMIT_MAX_ENTRIES"); ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			limits.MaxEntries = n
+		} else {
+			slog.Warn("ignoring RATE_LIMIT_MAX_ENTRIES: must be a number")
+		}
+	}
+	if value, ok := os.LookupEnv("RATE_LIMIT_CLEANUP_INTERVAL"); ok {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			limits.CleanupInterval = d
+		} else {
+			slog.Warn("ignoring RATE_LIMIT_CLEANUP_INTERVAL: must be a positive duration")
+		}
+	}
+
+	limits.Allowlist = loadPrefixes("RATE_LIMIT_ALLOWLIST")
+
+	return limits
+}
+
+func loadRateLimit(group string, def RateLimit) RateLimit {
+	rl := def
+
+	name := "RATE_LIMIT_" + group
+	if value, ok := os.LookupEnv(name); ok {
+		parsed, err := ParseRateLimit(value)
+		if err != nil {
+			slog.Warn("ignoring "+name, "error", err)
+		} else {
+			rl = parsed
+		}
+	}
+
+	if value, ok := os.LookupEnv(name + "_BURST"); ok {
+		burst, err := strconv.Atoi(value)
+		if err != nil || burst <= 0 {
+			slog.Warn("ignoring " + name + "_BURST: must be a positive number")
+		} else {
+			rl.Burst = burst
+		}
+	}
+
+	return rl
+}
+
+// ParseRateLimit parses "<requests>/<period>", e.g. "10/1m". The burst is the number of requests.
+func ParseRateLimit(value string) (RateLimit, error) {
+	requests, period, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("%q is not in the <requests>/<period> format", value)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n < 0 {
+		return RateLimit{}, fmt.Errorf("invalid number of requests %q", requests)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid period %q", period)
+	}
+
+	return RateLimit{Requests: n, Period: d, Burst: max(n, 1)}, nil
+}
+
+// ParsePrefix parses a CIDR, or a single IP address as a prefix of its full length
+func ParsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,46 @@
+package config_test
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	rl, err := config.ParseRateLimit("10/1m")
+	require.NoError(t, err)
+	assert.Equal(t, config.RateLimit{Requests: 10, Period: time.Minute, Burst: 10}, rl)
+	assert.Equal(t, rate.Every(6*time.Second), rl.Limit())
+
+	rl, err = config.ParseRateLimit("0/1m")
+	require.NoError(t, err)
+	assert.Equal(t, rate.Inf, rl.Limit())
+
+	for _, value := range []string{"10", "ten/1m", "10/forever", "-1/1m", "10/0s"} {
+		_, err := config.ParseRateLimit(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestLoadConfigRateLimits(t *testing.T) {
+	t.Setenv("RATE_LIMIT_FEEDBACK", "3/1h")
+	t.Setenv("RATE_LIMIT_FEEDBACK_BURST", "1")
+	t.Setenv("RATE_LIMIT_NETWORK", "invalid")
+	t.Setenv("RATE_LIMIT_ALLOWLIST", "10.0.0.0/8, 127.0.0.1,not-an-ip")
+	t.Setenv("TRUSTED_PROXIES", "172.16.0.0/12")
+
+	cfg := config.LoadConfig("testdata/missing.env")
+
+	assert.Equal(t, config.RateLimit{Requests: 3, Period: time.Hour, Burst: 1}, cfg.RateLimits.Feedback)
+	assert.Equal(t, config.RateLimit{Requests: 30, Period: time.Minute, Burst: 10}, cfg.RateLimits.Network)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("127.0.0.1/32"),
+	}, cfg.RateLimits.Allowlist)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("172.16.0.0/12")}, cfg.TrustedProxies)
+}
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jomei/notionapi"
+	"gorm.io/gorm"
+
+	"github.com/checkspeed/sc-backend/internal/auth"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/metrics"
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+const (
+	defaultFeedbackLimit = 50
+	maxFeedbackLimit     = 100 // largest page size of the Notion API
+)
+
+// DeleteSpeedtestResult deletes an abusive speed test result
+func (ct *Controller) DeleteSpeedtestResult(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	id := c.Param("id")
+	err := gorm.ErrRecordNotFound
+	if isUUID(id) {
+		err = ct.speedTRepo.Delete(ctx, id)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "Speed test result not found",
+				Code:    "NOT_FOUND",
+			})
+			return
+		}
+
+		logger.FromContext(c.Request.Context()).Error("failed to delete speed test result", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status:  models.StatusSuccess,
+		Message: "Speed test result deleted",
+	})
+}
+
+// ListFeedback returns the feedback stored in Notion, newest first. It is paginated with the
+// limit and cursor query parameters.
+func (ct *Controller) ListFeedback(c *gin.Context) {
+	limit := defaultFeedbackLimit
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "limit must be a positive number",
+				Code:    "INVALID_LIMIT",
+			})
+			return
+		}
+		limit = min(n, maxFeedbackLimit)
+	}
+
+	client := notionapi.NewClient(notionapi.Token(os.Getenv("NOTION_API_KEY")),
+		notionapi.WithHTTPClient(upstreamClient(metrics.UpstreamNotion)))
+	databaseID := notionapi.DatabaseID(os.Getenv("NOTION_DATABASE_ID"))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	resp, err := client.Database.Query(ctx, databaseID, &notionapi.DatabaseQueryRequest{
+		Sorts:       []notionapi.SortObject{{Timestamp: notionapi.TimestampCreated, Direction: notionapi.SortOrderDESC}},
+		StartCursor: notionapi.Cursor(c.Query("cursor")),
+		PageSize:    limit,
+	})
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to query feedback from notion", "error", err)
+		c.JSON(http.StatusBadGateway, models.ApiResp{
+			Status:  models.StatusError,
+			Message: "Failed to retrieve feedback",
+			Code:    "NOTION_ERROR",
+		})
+		return
+	}
+
+	feedback := make([]models.Feedback, 0, len(resp.Results))
+	for _, page := range resp.Results {
+		feedback = append(feedback, feedbackFromPage(page))
+	}
+
+	var nextCursor string
+	if resp.HasMore {
+		nextCursor = resp.NextCursor.String()
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status:     models.StatusSuccess,
+		Data:       feedback,
+		NextCursor: nextCursor,
+	})
+}
+
+// feedbackFromPage maps a page of the feedback database written by CreateFeedback
+func feedbackFromPage(page notionapi.Page) models.Feedback {
+	feedback := models.Feedback{
+		ID:        page.ID.String(),
+		URL:       page.URL,
+		CreatedAt: page.CreatedTime,
+	}
+
+	if p, ok := page.Properties["Subject"].(*notionapi.TitleProperty); ok {
+		feedback.Subject = plainText(p.Title)
+	}
+	if p, ok := page.Properties["Message"].(*notionapi.RichTextProperty); ok {
+		feedback.Message = plainText(p.RichText)
+	}
+	if p, ok := page.Properties["Email"].(*notionapi.EmailProperty); ok {
+		feedback.Email = p.Email
+	}
+	if p, ok := page.Properties["Date created"].(*notionapi.DateProperty); ok && p.Date != nil && p.Date.Start != nil {
+		feedback.CreatedAt = time.Time(*p.Date.Start)
+	}
+
+	return feedback
+}
+
+func plainText(richText []notionapi.RichText) string {
+	var b strings.Builder
+	for _, rt := range richText {
+		b.WriteString(rt.PlainText)
+	}
+	return b.String()
+}
+
+func (ct *Controller) ListAPIKeys(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	apiKeys, err := ct.apiKeysRepo.List(ctx)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to list api keys", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   apiKeys,
+	})
+}
+
+// CreateAPIKey creates a partner API key, the key is only part of this response
+func (ct *Controller) CreateAPIKey(c *gin.Context) {
+	var requestBody models.CreateAPIKey
+
+	if err := c.BindJSON(&requestBody); err != nil {
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
+			Code: "INVALID_BODY"})
+		return
+	}
+
+	requestBody.Name = strings.TrimSpace(requestBody.Name)
+	if requestBody.Name == "" || len(requestBody.Name) > 100 {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "name is required (max 100 characters)",
+			Code:    "INVALID_NAME",
+		})
+		return
+	}
+	if requestBody.DailyQuota < 0 {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "daily_quota must be a positive number",
+			Code:    "INVALID_QUOTA",
+		})
+		return
+	}
+	if requestBody.DailyQuota == 0 {
+		requestBody.DailyQuota = ct.cfg.PartnerDailyQuota
+	}
+
+	apiKey, err := auth.NewAPIKey(requestBody.Name, requestBody.DailyQuota)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to generate api key", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	if err := ct.apiKeysRepo.Create(ctx, apiKey.APIKey); err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to create api key", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   apiKey,
+	})
+}
+
+func (ct *Controller) RevokeAPIKey(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	id := c.Param("id")
+	err := gorm.ErrRecordNotFound
+	if isUUID(id) {
+		err = ct.apiKeysRepo.Revoke(ctx, id)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "API key not found",
+				Code:    "NOT_FOUND",
+			})
+			return
+		}
+
+		logger.FromContext(c.Request.Context()).Error("failed to revoke api key", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status:  models.StatusSuccess,
+		Message: "API key revoked",
+	})
+}
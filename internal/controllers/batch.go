@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/metrics"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/checkspeed/sc-backend/internal/validation"
+)
+
+// maxBatchSize is the maximum number of results accepted in a single batch submission
+const maxBatchSize = 100
+
+// CreateSpeedtestResultsBatch stores many speed test results at once, mainly for clients
+// syncing tests taken offline. Invalid results are reported per item while the valid ones
+// are stored together in a single transaction.
+func (ct *Controller) CreateSpeedtestResultsBatch(c *gin.Context) {
+	var requestBody []models.CreateSpeedTestResult
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	if err := c.BindJSON(&requestBody); err != nil {
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
+			Code: "INVALID_BODY"})
+		return
+	}
+
+	if len(requestBody) == 0 {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Batch must contain at least one result",
+			Code:    "EMPTY_BATCH"})
+		return
+	}
+	if len(requestBody) > maxBatchSize {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Batch too large (max 100 results)",
+			Code:    "BATCH_TOO_LARGE"})
+		return
+	}
+
+	resp := models.CreateSpeedTestResultsBatchResponse{
+		Results: make([]models.BatchItemStatus, len(requestBody)),
+	}
+	speedTestResults := make([]models.SpeedTestResults, 0, len(requestBody))
+	// position in requestBody of each entry of speedTestResults
+	indexes := make([]int, 0, len(requestBody))
+
+	for i, input := range requestBody {
+		item := &resp.Results[i]
+		item.Index = i
+
+		if errs := validation.ValidateSpeedTestResult(input); len(errs) > 0 {
+			item.Status = models.StatusFail
+			item.Code = "VALIDATION_ERROR"
+			item.Message = "Invalid speed test result"
+			item.Errors = errs
+			continue
+		}
+
+		testTime, err := ct.parseTestTime(input.TestTime)
+		if err != nil {
+			item.Status = models.StatusFail
+			item.Code = "INVALID_TEST_TIME"
+			item.Message = "Invalid test_time: " + err.Error()
+			continue
+		}
+
+		if err := ct.resolveTestServerID(ctx, &input); err != nil {
+			if errors.Is(err, errUnknownTestServer) {
+				item.Status = models.StatusFail
+				item.Code = "UNKNOWN_TEST_SERVER"
+				item.Message = "test_server_id or test_server_identifier does not belong to a registered test server"
+				continue
+			}
+
+			logger.FromContext(c.Request.Context()).Error("failed to resolve test server", "error", err)
+			c.JSON(http.StatusInternalServerError, models.ApiResp{
+				Status:  models.StatusError,
+				Message: "failed to resolve test server",
+				Code:    "INTERNAL_ERROR"})
+			return
+		}
+
+		deviceSecret, err := ct.resolveDeviceID(ctx, &input)
+		if err != nil {
+			if errors.Is(err, errUnknownDevice) {
+				item.Status = models.StatusFail
+				item.Code = "UNKNOWN_DEVICE"
+				item.Message = "device_id does not belong to a known device"
+				continue
+			}
+
+			logger.FromContext(c.Request.Context()).Error("failed to get or create device", "error", err)
+			c.JSON(http.StatusInternalServerError, models.ApiResp{
+				Status:  models.StatusError,
+				Message: "failed to get or create device",
+				Code:    "INTERNAL_ERROR"})
+			return
+		}
+		item.DeviceSecret = deviceSecret
+		ct.linkDeviceToUser(c, ctx, input.DeviceID, input.DeviceSecret)
+
+		speedTestResult, err := transformSpeedTestResult(input, testTime)
+		if err != nil {
+			item.Status = models.StatusFail
+			item.Code = "INVALID_RESULT"
+			item.Message = err.Error()
+			continue
+		}
+		// results whose client generated id was stored by an earlier sync of the device are
+		// not inserted again
+		if input.ID != "" {
+			key := input.ID
+			speedTestResult.IdempotencyKey = &key
+		}
+
+		speedTestResults = append(speedTestResults, speedTestResult)
+		indexes = append(indexes, i)
+	}
+
+	created, err := ct.speedTRepo.CreateBatch(ctx, speedTestResults)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to store speed test results", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{
+			Status:  models.StatusError,
+			Message: "failed to store speed test results",
+			Code:    "INTERNAL_ERROR"})
+		return
+	}
+
+	for j, i := range indexes {
+		resp.Results[i].Status = models.StatusSuccess
+		resp.Results[i].ID = speedTestResults[j].ID
+		resp.Results[i].DeviceID = speedTestResults[j].DeviceID
+		resp.Results[i].Replayed = !created[j]
+		if created[j] {
+			metrics.ResultsSubmitted(speedTestResults[j].CountryCode, 1)
+		}
+	}
+	for _, item := range resp.Results {
+		switch {
+		case item.Status != models.StatusSuccess:
+			resp.Failed++
+		case !item.Replayed:
+			resp.Created++
+		}
+	}
+
+	logger.FromContext(c.Request.Context()).Info("speed test results batch stored",
+		"created", resp.Created,
+		"failed", resp.Failed,
+	)
+
+	if resp.Failed == len(requestBody) {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "No valid speed test results in batch",
+			Code:    "VALIDATION_ERROR",
+			Data:    resp,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   resp,
+	})
+}
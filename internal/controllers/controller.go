@@ -3,9 +3,12 @@ package controllers
 import (
 	"context"
 	"crypto/sha1"
-	"fmt"
+	"errors"
+	"net/netip"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,14 +18,19 @@ import (
 	"github.com/jomei/notionapi"
 
 	"encoding/hex"
-	"encoding/json"
-	"log"
 	"net/http"
 
+	"github.com/checkspeed/sc-backend/internal/auth"
 	"github.com/checkspeed/sc-backend/internal/config"
 	"github.com/checkspeed/sc-backend/internal/db"
+	"github.com/checkspeed/sc-backend/internal/geo"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/metrics"
+	"github.com/checkspeed/sc-backend/internal/middleware"
 	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/checkspeed/sc-backend/internal/telemetry"
 	"github.com/checkspeed/sc-backend/internal/utils"
+	"github.com/checkspeed/sc-backend/internal/validation"
 )
 
 type Controller struct {
@@ -30,10 +38,38 @@ type Controller struct {
 	devicesRepo db.Devices
 	speedTRepo  db.SpeedTestResults
 	testSrvRepo db.TestServers
+	usersRepo   db.Users
+	apiKeysRepo db.APIKeys
+	tokens      *auth.TokenManager
+	geo         *geo.Chain
+	geoCache    *geo.Cache
+	localGeo    *geo.MMDB
+	store       db.Store
+	migrator    db.Migrator
+	draining    atomic.Bool
+
+	// remoteGeo is the chain of the geolocation apis without the cache, nil when none is configured
+	remoteGeo geo.Provider
+
+	// geoProbe is the last outcome of the geolocation readiness check, run at geoProbeAt
+	geoProbeMu sync.Mutex
+	geoProbe   models.HealthCheck
+	geoProbeAt time.Time
 }
 
 const Timelayout = "Mon, 02 Jan 2006 15:04:05 MST"
 
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 100
+)
+
+// testTimeLayouts are the formats accepted for the test_time of a submitted result
+var testTimeLayouts = []string{time.RFC3339, time.RFC1123, time.RFC1123Z, Timelayout}
+
+var errInvalidIP = errors.New("invalid ip address")
+
 func NewController(cfg config.Config, store db.Store) (*Controller, error) {
 	devicesRepo, err := db.NewDevicesRepo(store)
 	if err != nil {
@@ -47,23 +83,103 @@ func NewController(cfg config.Config, store db.Store) (*Controller, error) {
 	if err != nil {
 		return nil, err
 	}
+	usersRepo, err := db.NewUsersRepo(store)
+	if err != nil {
+		return nil, err
+	}
+	apiKeysRepo, err := db.NewAPIKeysRepo(store)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := auth.NewTokenManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := db.NewMigrator(store)
+	if err != nil {
+		return nil, err
+	}
+	var localGeo *geo.MMDB
+	if cfg.GeoIPDBPath != "" {
+		localGeo, err = geo.OpenMMDB(cfg.GeoIPDBPath, cfg.GeoIPASNDBPath, cfg.GeoIPReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var cacheStore geo.CacheStore
+	if cfg.GeoCache.TTL > 0 && cfg.GeoCache.Backend == config.GeoCacheBackendPostgres {
+		geoCacheRepo, err := db.NewGeoCacheRepo(store)
+		if err != nil {
+			return nil, err
+		}
+		cacheStore = geoCacheRepo
+	}
+	var geoCache *geo.Cache
+	var remoteGeo geo.Provider
+	cacheRemote := func(remote geo.Provider) geo.Provider {
+		remoteGeo = remote
+		if cfg.GeoCache.TTL <= 0 {
+			return remote
+		}
+		geoCache = geo.NewCache(remote, cfg.GeoCache, cacheStore)
+		return geoCache
+	}
+	geoChain, err := geo.NewFromConfig(cfg, upstreamClient, localGeo, cacheRemote)
+	if err != nil {
+		if localGeo != nil {
+			localGeo.Close()
+		}
+		return nil, err
+	}
 	return &Controller{
 		cfg:         cfg,
 		devicesRepo: devicesRepo,
 		speedTRepo:  speedTRepo,
 		testSrvRepo: testSrvRepo,
+		usersRepo:   usersRepo,
+		apiKeysRepo: apiKeysRepo,
+		tokens:      tokens,
+		geo:         geoChain,
+		geoCache:    geoCache,
+		localGeo:    localGeo,
+		remoteGeo:   remoteGeo,
+		store:       store,
+		migrator:    migrator,
 	}, nil
 }
 
+// Tokens returns the manager of the access tokens issued by the controller, for the auth middleware
+func (ct *Controller) Tokens() *auth.TokenManager {
+	return ct.tokens
+}
+
+// LocalGeo returns the local geolocation database, nil when GEOIP_DB_PATH is not set
+func (ct *Controller) LocalGeo() *geo.MMDB {
+	return ct.localGeo
+}
+
+// GeoCache returns the cache in front of the geolocation apis, nil when GEO_CACHE_TTL is 0 or
+// only the local database is used
+func (ct *Controller) GeoCache() *geo.Cache {
+	return ct.geoCache
+}
+
+// Users returns the users repo, for the role middleware
+func (ct *Controller) Users() db.Users {
+	return ct.usersRepo
+}
+
+// APIKeys returns the partner API keys repo, for the API key middleware
+func (ct *Controller) APIKeys() db.APIKeys {
+	return ct.apiKeysRepo
+}
+
 func (ct *Controller) CreateFeedback(c *gin.Context) {
 	var requestBody models.CreateFeedback
 
-	// Track when request started (used later for logging duration & timestamp)
-	startTime := time.Now()
-
 	// 1. Parse JSON body
 	if err := c.BindJSON(&requestBody); err != nil {
-		log.Printf("[%s] CreateFeedback - invalid request body: %s", startTime.Format(time.RFC3339), err.Error())
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
 		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
 			Code: "INVALID_BODY"})
 		return
@@ -118,7 +234,8 @@ func (ct *Controller) CreateFeedback(c *gin.Context) {
 	}
 
 	// 3. Prepare Notion payload : Initialize Notion client
-	client := notionapi.NewClient(notionapi.Token(os.Getenv("NOTION_API_KEY")))
+	client := notionapi.NewClient(notionapi.Token(os.Getenv("NOTION_API_KEY")),
+		notionapi.WithHTTPClient(upstreamClient(metrics.UpstreamNotion)))
 	databaseID := notionapi.DatabaseID(os.Getenv("NOTION_DATABASE_ID"))
 
 	// Create short preview (first 100 chars)
@@ -179,10 +296,7 @@ func (ct *Controller) CreateFeedback(c *gin.Context) {
 	})
 
 	if err != nil {
-		// Here we use %v, which also calls err.Error() under the hood
-		// (just showing both styles so you get familiar with them)
-		log.Printf("[%s] CreateFeedback - Notion error: %v",
-			startTime.Format(time.RFC3339), err)
+		logger.FromContext(c.Request.Context()).Error("failed to save feedback to notion", "error", err)
 
 		c.JSON(http.StatusInternalServerError, models.ApiResp{
 			Status:  models.StatusError,
@@ -192,11 +306,8 @@ func (ct *Controller) CreateFeedback(c *gin.Context) {
 		return
 	}
 
-	// 5. Log success (duration = how long the whole request took)
-	log.Printf("[%s] CreateFeedback - success duration=%v",
-		startTime.Format(time.RFC3339),
-		time.Since(startTime),
-	)
+	// 5. Log success
+	logger.FromContext(c.Request.Context()).Info("feedback saved")
 
 	c.JSON(http.StatusCreated, models.ApiResp{
 		Status:  models.StatusSuccess,
@@ -206,112 +317,139 @@ func (ct *Controller) CreateFeedback(c *gin.Context) {
 
 }
 
+// GetNetworkInfo returns the isp and location of the ip query parameter
 func (ct *Controller) GetNetworkInfo(c *gin.Context) {
+	info, ok := ct.networkInfo(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status:  models.StatusSuccess,
+		Message: "Success",
+		Data:    info,
+	})
+}
+
+// GetNetworkInfoLegacy returns the isp and location of the ip query parameter in the format of
+// the previous release, it is kept for one release while clients move to GetNetworkInfo
+func (ct *Controller) GetNetworkInfoLegacy(c *gin.Context) {
+	info, ok := ct.networkInfo(c)
+	if !ok {
+		return
+	}
 
-	startTime := time.Now()
+	c.Header("Deprecation", "true")
+	c.Header("Link", `</v2/network>; rel="successor-version"`)
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status:  models.StatusSuccess,
+		Message: "Success",
+		Data:    models.NewNetworkData(info),
+	})
+}
 
+// networkInfo locates the ip query parameter, writing the error response when it cannot
+func (ct *Controller) networkInfo(c *gin.Context) (models.GeoInfo, bool) {
 	ipAddr := c.Request.URL.Query().Get("ip")
 
 	if ipAddr == "" {
-		log.Printf("GetNetworkInfo - missing IP parameter from client: %s", c.ClientIP())
+		logger.FromContext(c.Request.Context()).Info("missing IP parameter")
 
 		c.JSON(http.StatusBadRequest, models.ApiResp{
 			Status:  models.StatusFail,
 			Message: "IP parameter is required",
 			Code:    "MISSING_IP",
 		})
-		return
+		return models.GeoInfo{}, false
 	}
 
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
 	defer cancel()
 
-	geoUrl := fmt.Sprintf("https://api.ipgeolocation.io/ipgeo?apiKey=%s&ip=%s", ct.cfg.GeoAPIKey, ipAddr)
+	info, err := ct.locateIP(ctx, ipAddr)
+	if err != nil {
+		ct.geoError(c, ipAddr, err)
+		return models.GeoInfo{}, false
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, geoUrl, nil)
+	logger.FromContext(c.Request.Context()).Debug("geolocation lookup succeeded", "ip", ipAddr, "provider", info.Provider)
+	return info, true
+}
 
+// locateIP returns the isp and location of ipAddr from the geolocation providers
+func (ct *Controller) locateIP(ctx context.Context, ipAddr string) (models.GeoInfo, error) {
+	ip, err := netip.ParseAddr(ipAddr)
 	if err != nil {
-		log.Printf("GetNetworkInfo - failed to create request for IP %s: %v", ipAddr, err)
-		c.JSON(http.StatusInternalServerError, models.ApiResp{
-			Status:  models.StatusError,
-			Message: "Internal server error",
-			Code:    "INTERNAL_ERROR",
-		})
-		return
+		return models.GeoInfo{}, errInvalidIP
 	}
+	return ct.geo.Lookup(ctx, ip.Unmap())
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// enrichResult fills the isp and location left empty in a submitted result from the local
+// geolocation database, without any network round trip. Results keep their own values and
+// coordinates, and are stored as they are when there is no local database or it has no data.
+// Only results submitted live are enriched: batched results were taken offline, possibly on
+// another network than the one they are uploaded from.
+func (ct *Controller) enrichResult(ctx context.Context, input *models.CreateSpeedTestResult, clientIP string) {
+	if ct.localGeo == nil || (input.ISP != "" && input.CountryCode != "") {
+		return
+	}
+	ip, err := netip.ParseAddr(clientIP)
 	if err != nil {
-		log.Printf("GetNetworkInfo - API call failed for IP %s: %v", ipAddr, err)
-		c.JSON(http.StatusBadGateway, models.ApiResp{
-			Status:  models.StatusError,
-			Message: "Geolocation service unavailable",
-			Code:    "SERVICE_ERROR",
-		})
+		return
+	}
+	info, err := ct.localGeo.Lookup(ctx, ip.Unmap())
+	if err != nil {
+		if !errors.Is(err, geo.ErrNotFound) {
+			logger.FromContext(ctx).Warn("failed to enrich speed test result", "error", err)
+		}
 		return
 	}
 
-	defer resp.Body.Close()
-
-	var respBody models.NetworkData
-	json.NewDecoder(resp.Body).Decode(&respBody)
-
-	// Log success with duration
-	duration := time.Since(startTime)
-	log.Printf("GetNetworkInfo - success for IP %s (took %v)", ipAddr, duration)
-	c.JSON(http.StatusOK, models.ApiResp{
-		Status:  models.StatusSuccess,
-		Message: "Success",
-		Data:    respBody,
-	})
+	if input.ISP == "" {
+		input.ISP = truncate(info.ISP, 50)
+	}
+	if input.CountryCode == "" {
+		input.State = truncate(info.Region, 50)
+		input.CountryCode = info.CountryCode
+		input.CountryName = truncate(info.CountryName, 50)
+		input.ContinentCode = info.ContinentCode
+		input.ContinentName = truncate(info.ContinentName, 50)
+	}
 }
 
-func (ct *Controller) GetGeoLocationInfo(c *gin.Context) {
-	startTime := time.Now()
-
-	ipAddr := c.Request.URL.Query().Get("ip")
-
-	if ipAddr == "" {
-		log.Printf("GetGeoLocationInfo - missing IP parameter from client: %s", c.ClientIP())
+// truncate cuts s to at most n characters, to fit the columns it is stored in
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
 
+// geoError writes the response for an error returned by locateIP
+func (ct *Controller) geoError(c *gin.Context, ipAddr string, err error) {
+	switch {
+	case errors.Is(err, errInvalidIP):
 		c.JSON(http.StatusBadRequest, models.ApiResp{
 			Status:  models.StatusFail,
-			Message: "IP parameter is required",
-			Code:    "MISSING_IP",
+			Message: "IP parameter must be an IPv4 or IPv6 address",
+			Code:    "INVALID_IP",
 		})
-		return
-	}
-
-	geoUrl := fmt.Sprintf("https://get.geojs.io/v1/ip/geo.json?ip=%s", ipAddr)
-	resp, err := http.Get(geoUrl)
-
-	if err != nil {
-		log.Printf("GetGeoLocationInfo - API call failed: %v", err)
-
+	case errors.Is(err, geo.ErrNotFound):
+		c.JSON(http.StatusUnprocessableEntity, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Unable to locate IP address",
+			Code:    "UNKNOWN_LOCATION",
+		})
+	default:
+		logger.FromContext(c.Request.Context()).Error("geolocation lookup failed", "ip", ipAddr, "error", err)
 		c.JSON(http.StatusBadGateway, models.ApiResp{
 			Status:  models.StatusError,
-			Message: "GetGeoLocationInfo service unavailable",
+			Message: "Geolocation service unavailable",
 			Code:    "SERVICE_ERROR",
 		})
-		return
 	}
-
-	defer resp.Body.Close()
-
-	var respBody models.GeoLocationData
-	json.NewDecoder(resp.Body).Decode(&respBody)
-
-	// send response to user
-	duration := time.Since(startTime)
-
-	log.Printf("GetGeoLocationInfo - success for IP %s (took %v)", ipAddr, duration)
-	c.JSON(http.StatusOK, models.ApiResp{
-		Status:  models.StatusSuccess,
-		Message: "Success",
-		Data:    respBody,
-	})
 }
 
 func (ct *Controller) CreateSpeedtestResults(c *gin.Context) {
@@ -323,124 +461,344 @@ func (ct *Controller) CreateSpeedtestResults(c *gin.Context) {
 	defer cancel()
 
 	if err := c.BindJSON(&requestBody); err != nil {
-		log.Println("CreateSpeedTestResult - invalid request body: ", err.Error())
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
 		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
 			Code: "INVALID_BODY"})
 		return
 	}
 
-	// Get or create device if deviceID is not provided in request body
-	if requestBody.DeviceID == "" || requestBody.DeviceID == "undefined" {
-		deviceIdentifier := Hash([]string{requestBody.Device.OS, requestBody.Device.ScreenResolution, requestBody.Device.DeviceIP})
-		device := models.Device{
-			ID:               uuid.NewString(),
-			Identifier:       deviceIdentifier,
-			OS:               requestBody.Device.OS,
-			DeviceType:       "Desktop",
-			Manufacturer:     requestBody.Device.Manufacturer,
-			Model:            requestBody.Device.Model,
-			ScreenResolution: requestBody.Device.ScreenResolution,
-			IsPlatformDevice: true,
-		}
+	if errs := validation.ValidateSpeedTestResult(requestBody); len(errs) > 0 {
+		logger.FromContext(c.Request.Context()).Info("invalid speed test result", "error", errs.Error())
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Invalid speed test result",
+			Code:    "VALIDATION_ERROR",
+			Errors:  errs,
+		})
+		return
+	}
 
-		// Get device by identifier if it exists
-		deviceID, err := ct.devicesRepo.GetIDByIdentifier(ctx, device.Identifier)
-		if err != nil {
-			if err != gorm.ErrRecordNotFound {
-				log.Println("CreateSpeedTestResult - failed to get or create device: ", err.Error())
-				c.JSON(http.StatusInternalServerError, models.ApiResp{
-					Status:  models.StatusError,
-					Message: "failed to get or create device",
-					Code:    "INTERNAL_ERROR"})
-				return
-			}
-		}
+	// Retried submissions carry the key of the original request, either in the
+	// Idempotency-Key header or as a client generated result id. Keys are scoped to the
+	// submitting device, the stored result always gets an id generated here.
+	idempotencyKey := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+	if idempotencyKey == "" {
+		idempotencyKey = requestBody.ID
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Idempotency key too long (max 100 characters)",
+			Code:    "INVALID_IDEMPOTENCY_KEY"})
+		return
+	}
+
+	testTime, err := ct.parseTestTime(requestBody.TestTime)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Info("invalid test time", "error", err)
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Invalid test_time: " + err.Error(),
+			Code:    "INVALID_TEST_TIME"})
+		return
+	}
+
+	ct.enrichResult(ctx, &requestBody, c.ClientIP())
 
-		// Create device if it doesn't exist
-		if deviceID == "" {
-			err := ct.devicesRepo.Create(ctx, device)
-			if err != nil {
-				log.Println("CreateSpeedTestResult - failed to get or create device: ", err.Error())
-				c.JSON(http.StatusInternalServerError, models.ApiResp{
-					Status:  models.StatusError,
-					Message: "failed to get or create device",
-					Code:    "INTERNAL_ERROR"})
-				return
-			}
-			deviceID = device.ID
+	if err := ct.resolveTestServerID(ctx, &requestBody); err != nil {
+		if errors.Is(err, errUnknownTestServer) {
+			c.JSON(http.StatusBadRequest, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "test_server_id or test_server_identifier does not belong to a registered test server",
+				Code:    "UNKNOWN_TEST_SERVER"})
+			return
 		}
 
-		requestBody.DeviceID = deviceID
+		logger.FromContext(c.Request.Context()).Error("failed to resolve test server", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{
+			Status:  models.StatusError,
+			Message: "failed to resolve test server",
+			Code:    "INTERNAL_ERROR"})
+		return
 	}
 
-	// TODO: Validate provided device id
+	// Get or create device if deviceID is not provided in request body
+	deviceSecret, err := ct.resolveDeviceID(ctx, &requestBody)
+	if err != nil {
+		if errors.Is(err, errUnknownDevice) {
+			c.JSON(http.StatusBadRequest, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "device_id does not belong to a known device",
+				Code:    "UNKNOWN_DEVICE"})
+			return
+		}
+
+		logger.FromContext(c.Request.Context()).Error("failed to get or create device", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{
+			Status:  models.StatusError,
+			Message: "failed to get or create device",
+			Code:    "INTERNAL_ERROR"})
+		return
+	}
+	ct.linkDeviceToUser(c, ctx, requestBody.DeviceID, requestBody.DeviceSecret)
 
-	speedTestResult, err := transformSpeedTestResult(requestBody)
+	speedTestResult, err := transformSpeedTestResult(requestBody, testTime)
 	if err != nil {
-		log.Println("failed to transform input: ", err.Error())
-		c.JSON(http.StatusInternalServerError, models.ApiResp{Message: err.Error()})
+		logger.FromContext(c.Request.Context()).Error("failed to transform input", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{
+			Status:  models.StatusError,
+			Message: "failed to store speed test results",
+			Code:    "INTERNAL_ERROR"})
 		return
 	}
-	if err := ct.speedTRepo.Create(ctx, &speedTestResult); err != nil {
-		log.Println("failed to store speed test results: ", err.Error())
-		c.JSON(http.StatusInternalServerError, models.ApiResp{Message: err.Error()})
+	if idempotencyKey != "" {
+		speedTestResult.IdempotencyKey = &idempotencyKey
+	}
+
+	created, err := ct.speedTRepo.CreateIdempotent(ctx, &speedTestResult)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to store speed test results", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{
+			Status:  models.StatusError,
+			Message: "failed to store speed test results",
+			Code:    "INTERNAL_ERROR"})
 		return
 	}
+	if created {
+		metrics.ResultsSubmitted(speedTestResult.CountryCode, 1)
+	} else {
+		c.Header(IdempotentReplayedHeader, "true")
+	}
 
 	apiResp := models.CreateSpeedTestResultResponse{
-		Message:  "success",
-		DeviceID: speedTestResult.DeviceID,
+		Message:      "success",
+		DeviceID:     speedTestResult.DeviceID,
+		DeviceSecret: deviceSecret,
+		ID:           speedTestResult.ID,
+		Replayed:     !created,
 	}
 
 	c.JSON(http.StatusOK, apiResp)
 }
 
+// upstreamClient returns an http client whose requests to upstream are traced and recorded in the metrics
+func upstreamClient(upstream string) *http.Client {
+	return &http.Client{Transport: metrics.Transport(upstream, telemetry.Transport(nil))}
+}
+
+// linkDeviceToUser links the device a result was submitted from to the authenticated user, if any,
+// when secret is the one issued with the device. Devices submitted without their secret or
+// already linked to another user are left alone, the result is stored either way.
+func (ct *Controller) linkDeviceToUser(c *gin.Context, ctx context.Context, deviceID, secret string) {
+	userID, ok := middleware.UserID(c)
+	if !ok || secret == "" {
+		return
+	}
+
+	err := ct.devicesRepo.LinkUser(ctx, deviceID, userID, auth.HashDeviceSecret(secret))
+	if err != nil && !errors.Is(err, db.ErrDeviceLinked) && !errors.Is(err, db.ErrDeviceSecret) {
+		logger.FromContext(c.Request.Context()).Error("failed to link device to user", "device_id", deviceID, "user_id", userID, "error", err)
+	}
+}
+
+// resolveDeviceID checks that a device id provided by the client belongs to a known device.
+// When no id was provided it sets the id of the device with the same identifier, creating the
+// device from input.Device if there is none. The secret of a created device is returned and set
+// as input.DeviceSecret, it is empty when the device already existed.
+func (ct *Controller) resolveDeviceID(ctx context.Context, input *models.CreateSpeedTestResult) (string, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "resolveDeviceID")
+	defer span.End()
+
+	if input.DeviceID != "" && input.DeviceID != "undefined" {
+		if !isUUID(input.DeviceID) {
+			return "", errUnknownDevice
+		}
+		_, err := ct.devicesRepo.GetByID(ctx, input.DeviceID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", errUnknownDevice
+		}
+		return "", err
+	}
+
+	deviceIdentifier := Hash([]string{input.Device.OS, input.Device.ScreenResolution, input.Device.DeviceIP})
+	device := models.Device{
+		ID:               uuid.NewString(),
+		Identifier:       deviceIdentifier,
+		OS:               input.Device.OS,
+		DeviceType:       "Desktop",
+		Manufacturer:     input.Device.Manufacturer,
+		Model:            input.Device.Model,
+		ScreenResolution: input.Device.ScreenResolution,
+		IsPlatformDevice: true,
+	}
+
+	// Get device by identifier if it exists
+	deviceID, err := ct.devicesRepo.GetIDByIdentifier(ctx, device.Identifier)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return "", err
+	}
+	if deviceID != "" {
+		input.DeviceID = deviceID
+		return "", nil
+	}
+
+	// Create device if it doesn't exist, the client gets its secret to link it to a user later
+	secret, secretHash, err := auth.NewDeviceSecret()
+	if err != nil {
+		return "", err
+	}
+	device.SecretHash = &secretHash
+	if err := ct.devicesRepo.Create(ctx, device); err != nil {
+		return "", err
+	}
+
+	input.DeviceID = device.ID
+	input.DeviceSecret = secret
+	return secret, nil
+}
+
+// GetSpeedtestResults returns a page of the results matching the filters in the request body,
+// without their device ids
 func (ct *Controller) GetSpeedtestResults(c *gin.Context) {
-	startTime := time.Now()
+	ct.getSpeedtestResults(c, false)
+}
+
+// AdminGetSpeedtestResults is GetSpeedtestResults returning the raw results, device ids included
+func (ct *Controller) AdminGetSpeedtestResults(c *gin.Context) {
+	ct.getSpeedtestResults(c, true)
+}
 
+func (ct *Controller) getSpeedtestResults(c *gin.Context, raw bool) {
 	var filters db.GetSpeedTestResultsFilter
 
 	if err := c.BindJSON(&filters); err != nil {
-		log.Printf("GetSpeedTestResultsFilter - invalid request body: %s", err.Error())
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
 
 		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
 			Code: "INVALID_BODY"})
 		return
 	}
+	if !raw && filters.DeviceID != "" {
+		deviceFilterError(c)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
 	defer cancel()
 
-	results, err := ct.speedTRepo.Get(ctx, filters)
+	results, nextCursor, err := ct.speedTRepo.Get(ctx, filters)
 	if err != nil {
-		log.Printf("GetSpeedTestResults: failed to retrieve speed test results: %s", err.Error())
+		if errors.Is(err, db.ErrInvalidFilter) || errors.Is(err, db.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: err.Error(),
+				Code: "INVALID_FILTER"})
+			return
+		}
+
+		logger.FromContext(c.Request.Context()).Error("failed to retrieve speed test results", "error", err)
 
 		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
 			Code: "INTERNAL_ERROR"})
 		return
 	}
 
-	// send response to user
-	duration := time.Since(startTime)
+	logger.FromContext(c.Request.Context()).Debug("speed test results retrieved", "count", len(results))
+
+	var data any = models.PublicSpeedTestResults(results)
+	if raw {
+		data = results
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status:     models.StatusSuccess,
+		Data:       data,
+		NextCursor: nextCursor,
+	})
+}
+
+func (ct *Controller) GetSpeedtestResultsStats(c *gin.Context) {
+	var filters db.GetSpeedTestResultsStatsFilter
+
+	if err := c.BindJSON(&filters); err != nil {
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
+
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
+			Code: "INVALID_BODY"})
+		return
+	}
+	if filters.DeviceID != "" {
+		deviceFilterError(c)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	stats, err := ct.speedTRepo.GetStats(ctx, filters)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: err.Error(),
+				Code: "INVALID_FILTER"})
+			return
+		}
+
+		logger.FromContext(c.Request.Context()).Error("failed to aggregate speed test results", "error", err)
 
-	log.Printf("[%s] GetSpeedTestResults - retrieved success duration=%v",
-		startTime.Format(time.RFC3339),
-		duration,
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	logger.FromContext(c.Request.Context()).Debug("speed test results aggregated",
+		"group_by", filters.GroupBy,
+		"groups", len(stats),
 	)
 
 	c.JSON(http.StatusOK, models.ApiResp{
 		Status: models.StatusSuccess,
-		Data:   results,
+		Data:   stats,
+	})
+}
+
+// deviceFilterError rejects a device_id filter on the public and partner endpoints, the results
+// of a device linked to a user are only read by its owner through /devices/:id/results
+func deviceFilterError(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, models.ApiResp{
+		Status:  models.StatusFail,
+		Message: "device_id is not a supported filter, use /devices/:id/results",
+		Code:    "INVALID_FILTER",
 	})
 }
 
-func transformSpeedTestResult(input models.CreateSpeedTestResult) (models.SpeedTestResults, error) {
-	// testTime, err := time.Parse(time.RFC1123, input.TestTime)
-	// if err != nil {
-	// 	return models.SpeedTestResult{}, err
-	// }
+// parseTestTime parses the test_time reported by a client and checks it is neither in the future
+// nor older than the configured window. Results without a test_time are stamped with the current time.
+func (ct *Controller) parseTestTime(value string) (time.Time, error) {
+	now := time.Now().UTC()
+	if strings.TrimSpace(value) == "" {
+		return now, nil
+	}
+
+	testTime, err := utils.ParseTime(value, testTimeLayouts...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := utils.CheckTimeWindow(testTime, now, ct.cfg.TestTimeMaxAge); err != nil {
+		return time.Time{}, err
+	}
+	return testTime, nil
+}
+
+// transformSpeedTestResult converts a submitted result into its stored form.
+// testTime is when the client ran the test while CreatedAt records when we received it.
+func transformSpeedTestResult(input models.CreateSpeedTestResult, testTime time.Time) (models.SpeedTestResults, error) {
+	now := time.Now().UTC()
+
+	var testServerID *string
+	if input.TestServerID != "" {
+		testServerID = &input.TestServerID
+	}
+
 	return models.SpeedTestResults{
-		ID:               uuid.NewString(),
+		ID:               uuid.NewString(), // the client id is only an idempotency key
 		DownloadSpeed:    input.DownloadSpeed,
 		MaxDownloadSpeed: input.MaxDownloadSpeed,
 		MinDownloadSpeed: input.MinDownloadSpeed,
@@ -460,7 +818,7 @@ func transformSpeedTestResult(input models.CreateSpeedTestResult) (models.SpeedT
 		ConnectionType:   input.ConnectionType,
 		ConnectionDevice: input.ConnectionDevice,
 		TestPlatform:     input.TestPlatform,
-		ServerName:       input.ServerName,
+		TestServerID:     testServerID,
 		State:            input.State,
 		CountryCode:      input.CountryCode,
 		CountryName:      input.CountryName,
@@ -469,10 +827,9 @@ func transformSpeedTestResult(input models.CreateSpeedTestResult) (models.SpeedT
 		Longitude:        input.Longitude,
 		Latitude:         input.Latitude,
 		LocationAccess:   input.LocationAccess,
-		// TestTime:         testTime,
-		TestTime:  time.Now(),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		TestTime:         testTime,
+		CreatedAt:        now,
+		UpdatedAt:        now,
 	}, nil
 }
 
@@ -483,3 +840,9 @@ func Hash(input []string) string {
 	h.Write([]byte(s))
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// isUUID reports whether s is a valid uuid, ids are checked before querying uuid columns
+func isUUID(s string) bool {
+	_, err := uuid.Parse(s)
+	return err == nil
+}
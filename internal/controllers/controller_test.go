@@ -15,12 +15,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/checkspeed/sc-backend/internal/auth"
 	"github.com/checkspeed/sc-backend/internal/config"
 	"github.com/checkspeed/sc-backend/internal/controllers"
 	"github.com/checkspeed/sc-backend/internal/db"
+	"github.com/checkspeed/sc-backend/internal/middleware"
 	"github.com/checkspeed/sc-backend/internal/models"
 	"github.com/gin-gonic/gin"
 
+	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
@@ -121,7 +124,7 @@ func Test_CreateSpeedtestResults(t *testing.T) {
 	// init db\
 	// init repos
 	// init controller
-	cfg := config.Config{}
+	cfg := config.Config{JWTSecret: "test-secret"}
 	ctrl, err := controllers.NewController(cfg, store)
 	require.NoError(t, err)
 
@@ -239,4 +242,433 @@ func Test_CreateSpeedtestResults(t *testing.T) {
 
 		})
 	}
-}
\ No newline at end of file
+}
+func Test_CreateSpeedtestResultsBatch(t *testing.T) {
+	cfg := config.Config{JWTSecret: "test-secret"}
+	ctrl, err := controllers.NewController(cfg, store)
+	require.NoError(t, err)
+
+	router := gin.Default()
+	router.POST("/speedtest/batch", ctrl.CreateSpeedtestResultsBatch)
+
+	t.Run("OK - invalid results are reported per item", func(t *testing.T) {
+		requestJson := `[
+			{
+				"download_speed":19000,
+				"upload_speed":7200,
+				"latency":46,
+				"isp":"Starlink Internet Services Nigeria Ltd",
+				"isp_code":"STARLINK",
+				"connection_type":"4g",
+				"country_code":"NG",
+				"test_time":"2024-07-08T21:46:42.279Z",
+				"device":{"device_ip":"batch-ip-addr","os":"Android","screen_resolution":"1080x2400"}
+			},
+			{
+				"download_speed":21000,
+				"upload_speed":6900,
+				"latency":0,
+				"connection_type":"4g",
+				"test_time":"2024-07-08T22:46:42.279Z",
+				"device":{"device_ip":"batch-ip-addr","os":"Android","screen_resolution":"1080x2400"}
+			}
+		]`
+
+		req, err := http.NewRequest(http.MethodPost, "/speedtest/batch", bytes.NewBuffer([]byte(requestJson)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data models.CreateSpeedTestResultsBatchResponse `json:"data"`
+		}
+		err = json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, response.Data.Created)
+		assert.Equal(t, 1, response.Data.Failed)
+		require.Len(t, response.Data.Results, 2)
+		assert.Equal(t, models.StatusSuccess, response.Data.Results[0].Status)
+		assert.NotEmpty(t, response.Data.Results[0].ID)
+		assert.Equal(t, models.StatusFail, response.Data.Results[1].Status)
+		assert.Equal(t, "VALIDATION_ERROR", response.Data.Results[1].Code)
+	})
+
+	t.Run("Fail - empty batch", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/speedtest/batch", bytes.NewBuffer([]byte(`[]`)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_CreateSpeedtestResults_Idempotency(t *testing.T) {
+	cfg := config.Config{JWTSecret: "test-secret"}
+	ctrl, err := controllers.NewController(cfg, store)
+	require.NoError(t, err)
+
+	router := gin.Default()
+	router.POST("/speedtest", ctrl.CreateSpeedtestResults)
+
+	requestJson := `{
+		"download_speed":19000,
+		"upload_speed":7200,
+		"latency":46,
+		"connection_type":"4g",
+		"test_time":"2024-07-08T21:46:42.279Z",
+		"device":{"device_ip":"idempotency-ip-addr","os":"Android","screen_resolution":"1080x2400"}
+	}`
+
+	submit := func(t *testing.T) (int, models.CreateSpeedTestResultResponse) {
+		req, err := http.NewRequest(http.MethodPost, "/speedtest", bytes.NewBuffer([]byte(requestJson)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(controllers.IdempotencyKeyHeader, "retry-key-1")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response models.CreateSpeedTestResultResponse
+		err = json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+		return w.Code, response
+	}
+
+	code, first := submit(t)
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, first.Replayed)
+	assert.NotEmpty(t, first.ID)
+
+	code, second := submit(t)
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, second.Replayed)
+	assert.Equal(t, first.ID, second.ID)
+
+	t.Run("ids of other devices are not replayed", func(t *testing.T) {
+		otherJson := `{
+			"id":"` + first.ID + `",
+			"download_speed":19000,
+			"upload_speed":7200,
+			"latency":46,
+			"device":{"device_ip":"other-idempotency-ip-addr","os":"Android","screen_resolution":"1080x2400"}
+		}`
+		req, err := http.NewRequest(http.MethodPost, "/speedtest", bytes.NewBuffer([]byte(otherJson)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.CreateSpeedTestResultResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.False(t, response.Replayed)
+		assert.NotEqual(t, first.ID, response.ID)
+		assert.NotEqual(t, first.DeviceID, response.DeviceID)
+	})
+}
+
+func Test_CreateSpeedtestResults_UnknownDevice(t *testing.T) {
+	cfg := config.Config{JWTSecret: "test-secret"}
+	ctrl, err := controllers.NewController(cfg, store)
+	require.NoError(t, err)
+
+	router := gin.Default()
+	router.POST("/speedtest", ctrl.CreateSpeedtestResults)
+
+	requestJson := `{
+		"download_speed":19000,
+		"upload_speed":7200,
+		"latency":46,
+		"device_id":"5b0c1a43-5d2b-4a47-8c1d-2f1f6d0e9a11"
+	}`
+	req, err := http.NewRequest(http.MethodPost, "/speedtest", bytes.NewBuffer([]byte(requestJson)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response models.ApiResp
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "UNKNOWN_DEVICE", response.Code)
+}
+
+func Test_CreateSpeedtestResults_InvalidTestTime(t *testing.T) {
+	cfg := config.Config{JWTSecret: "test-secret"}
+	ctrl, err := controllers.NewController(cfg, store)
+	require.NoError(t, err)
+
+	router := gin.Default()
+	router.POST("/speedtest", ctrl.CreateSpeedtestResults)
+
+	requestJson := `{
+		"download_speed":19000,
+		"upload_speed":7200,
+		"latency":46,
+		"test_time":"yesterday",
+		"device":{"device_ip":"invalid-test-time-ip","os":"Android","screen_resolution":"1080x2400"}
+	}`
+	req, err := http.NewRequest(http.MethodPost, "/speedtest", bytes.NewBuffer([]byte(requestJson)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response models.ApiResp
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "INVALID_TEST_TIME", response.Code)
+
+	// the device is not created for a rejected result
+	devicesRepo, err := db.NewDevicesRepo(store)
+	require.NoError(t, err)
+	_, err = devicesRepo.GetIDByIdentifier(context.Background(), controllers.Hash([]string{"Android", "1080x2400", "invalid-test-time-ip"}))
+	assert.Error(t, err)
+}
+
+func Test_CreateSpeedtestResults_TestServer(t *testing.T) {
+	cfg := config.Config{JWTSecret: "test-secret"}
+	ctrl, err := controllers.NewController(cfg, store)
+	require.NoError(t, err)
+
+	router := gin.Default()
+	router.POST("/speedtest", ctrl.CreateSpeedtestResults)
+
+	testSrvRepo, err := db.NewTestServerRepo(store)
+	require.NoError(t, err)
+	testServer := models.TestServer{ID: uuid.NewString(), Identifier: "abuja-1", Name: "Abuja 1", Country: "NG", IsActive: true}
+	require.NoError(t, testSrvRepo.Create(context.Background(), testServer))
+
+	submit := func(t *testing.T, server string) (int, models.ApiResp) {
+		requestJson := `{
+			"download_speed":19000,
+			"upload_speed":7200,
+			"latency":46,
+			` + server + `,
+			"device":{"device_ip":"test-server-ip-addr","os":"Android","screen_resolution":"1080x2400"}
+		}`
+		req, err := http.NewRequest(http.MethodPost, "/speedtest", bytes.NewBuffer([]byte(requestJson)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response models.ApiResp
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	t.Run("OK - linked by identifier or server_name", func(t *testing.T) {
+		code, _ := submit(t, `"test_server_identifier":"abuja-1"`)
+		assert.Equal(t, http.StatusOK, code)
+
+		code, _ = submit(t, `"server_name":"abuja-1"`)
+		assert.Equal(t, http.StatusOK, code)
+
+		code, _ = submit(t, `"server_name":"Harare, ZW - Lagos, NG"`)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("Fail - unknown servers are not registered", func(t *testing.T) {
+		code, response := submit(t, `"test_server_identifier":"unregistered-1"`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "UNKNOWN_TEST_SERVER", response.Code)
+
+		_, err := testSrvRepo.GetByIdentifier(context.Background(), "unregistered-1")
+		assert.Error(t, err)
+	})
+}
+
+func Test_DeviceOwnership(t *testing.T) {
+	cfg := config.Config{JWTSecret: "test-secret"}
+	ctrl, err := controllers.NewController(cfg, store)
+	require.NoError(t, err)
+
+	router := gin.Default()
+	router.GET("/devices/:id", middleware.OptionalAuth(ctrl.Tokens()), ctrl.GetDevice)
+	router.GET("/devices/:id/results", middleware.OptionalAuth(ctrl.Tokens()), ctrl.GetDeviceResults)
+	router.PATCH("/devices/:id", middleware.OptionalAuth(ctrl.Tokens()), ctrl.UpdateDevice)
+	router.POST("/speed_test_result/list", ctrl.GetSpeedtestResults)
+
+	ctx := context.Background()
+	usersRepo, err := db.NewUsersRepo(store)
+	require.NoError(t, err)
+	devicesRepo, err := db.NewDevicesRepo(store)
+	require.NoError(t, err)
+
+	owner := models.User{ID: uuid.NewString(), Username: "device-owner", Email: "device-owner@example.com", PasswordHash: "x"}
+	other := models.User{ID: uuid.NewString(), Username: "device-other", Email: "device-other@example.com", PasswordHash: "x"}
+	require.NoError(t, usersRepo.Create(ctx, owner))
+	require.NoError(t, usersRepo.Create(ctx, other))
+
+	secret, secretHash, err := auth.NewDeviceSecret()
+	require.NoError(t, err)
+	device := models.Device{ID: uuid.NewString(), Identifier: "owned-device", OS: "Android", SecretHash: &secretHash}
+	require.NoError(t, devicesRepo.Create(ctx, device))
+	require.NoError(t, devicesRepo.LinkUser(ctx, device.ID, owner.ID, auth.HashDeviceSecret(secret)))
+
+	request := func(t *testing.T, method, path, userID string) int {
+		req, err := http.NewRequest(method, path, bytes.NewBuffer([]byte(`{"model":"Pixel 8"}`)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if userID != "" {
+			token, _, err := ctrl.Tokens().Issue(userID, models.RoleUser)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	routes := []struct{ method, path string }{
+		{http.MethodGet, "/devices/" + device.ID},
+		{http.MethodGet, "/devices/" + device.ID + "/results"},
+		{http.MethodPatch, "/devices/" + device.ID},
+	}
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			assert.Equal(t, http.StatusUnauthorized, request(t, route.method, route.path, ""))
+			assert.Equal(t, http.StatusForbidden, request(t, route.method, route.path, other.ID))
+			assert.Equal(t, http.StatusOK, request(t, route.method, route.path, owner.ID))
+		})
+	}
+
+	t.Run("Fail - device_id filter on the public list", func(t *testing.T) {
+		body := `{"device_id":"` + device.ID + `"}`
+		req, err := http.NewRequest(http.MethodPost, "/speed_test_result/list", bytes.NewBuffer([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_LinkUserDevice(t *testing.T) {
+	cfg := config.Config{JWTSecret: "test-secret"}
+	ctrl, err := controllers.NewController(cfg, store)
+	require.NoError(t, err)
+
+	router := gin.Default()
+	router.POST("/speedtest", middleware.OptionalAuth(ctrl.Tokens()), ctrl.CreateSpeedtestResults)
+	router.POST("/users/:id/devices", middleware.RequireAuth(ctrl.Tokens()), middleware.RequireSameUser("id"), ctrl.LinkUserDevice)
+	router.GET("/devices/:id", middleware.OptionalAuth(ctrl.Tokens()), ctrl.GetDevice)
+
+	ctx := context.Background()
+	usersRepo, err := db.NewUsersRepo(store)
+	require.NoError(t, err)
+	owner := models.User{ID: uuid.NewString(), Username: "link-owner", Email: "link-owner@example.com", PasswordHash: "x"}
+	other := models.User{ID: uuid.NewString(), Username: "link-other", Email: "link-other@example.com", PasswordHash: "x"}
+	require.NoError(t, usersRepo.Create(ctx, owner))
+	require.NoError(t, usersRepo.Create(ctx, other))
+
+	request := func(t *testing.T, method, path, userID, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, bytes.NewBuffer([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if userID != "" {
+			token, _, err := ctrl.Tokens().Issue(userID, models.RoleUser)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// the device is created by an anonymous submission, only that client gets its secret
+	w := request(t, http.MethodPost, "/speedtest", "", `{
+		"download_speed":19000,
+		"upload_speed":7200,
+		"latency":46,
+		"device":{"device_ip":"link-device-ip","os":"Android","screen_resolution":"1080x2400"}
+	}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var created models.CreateSpeedTestResultResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.NotEmpty(t, created.DeviceSecret)
+
+	t.Run("Fail - results submitted with the device id do not link it", func(t *testing.T) {
+		w := request(t, http.MethodPost, "/speedtest", other.ID,
+			`{"download_speed":19000,"upload_speed":7200,"latency":46,"device_id":"`+created.DeviceID+`"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = request(t, http.MethodGet, "/devices/"+created.DeviceID, "", "")
+		assert.Equal(t, http.StatusOK, w.Code, "the device is still not linked")
+	})
+
+	t.Run("Fail - wrong secret", func(t *testing.T) {
+		for _, secret := range []string{"", "scd_guessed"} {
+			w := request(t, http.MethodPost, "/users/"+other.ID+"/devices", other.ID,
+				`{"device_id":"`+created.DeviceID+`","device_secret":"`+secret+`"}`)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		}
+	})
+
+	t.Run("OK - linked with the secret", func(t *testing.T) {
+		w := request(t, http.MethodPost, "/users/"+owner.ID+"/devices", owner.ID,
+			`{"device_id":"`+created.DeviceID+`","device_secret":"`+created.DeviceSecret+`"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = request(t, http.MethodPost, "/users/"+other.ID+"/devices", other.ID,
+			`{"device_id":"`+created.DeviceID+`","device_secret":"`+created.DeviceSecret+`"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
+
+func Test_Readyz(t *testing.T) {
+	cfg := config.Config{JWTSecret: "test-secret"}
+	ctrl, err := controllers.NewController(cfg, store)
+	require.NoError(t, err)
+
+	router := gin.Default()
+	router.GET("/readyz", ctrl.Readyz)
+
+	readyz := func(t *testing.T) (int, models.Readiness) {
+		req, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.Readiness `json:"data"`
+		}
+		err = json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+		return w.Code, response.Data
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		code, readiness := readyz(t)
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, readiness.Ready)
+		assert.Equal(t, models.CheckOK, readiness.Checks["database"].Status)
+		assert.Equal(t, models.CheckOK, readiness.Checks["migrations"].Status)
+		assert.NotContains(t, readiness.Checks, "geolocation")
+	})
+
+	t.Run("not ready while draining", func(t *testing.T) {
+		ctrl.SetDraining()
+
+		code, readiness := readyz(t)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.False(t, readiness.Ready)
+		assert.True(t, readiness.Draining)
+	})
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/checkspeed/sc-backend/internal/db"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/middleware"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/checkspeed/sc-backend/internal/validation"
+)
+
+var errUnknownDevice = errors.New("unknown device")
+
+func (ct *Controller) GetDevice(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	device, err := ct.getDevice(ctx, c.Param("id"))
+	if err != nil {
+		ct.deviceError(c, "GetDevice", err)
+		return
+	}
+	if !ct.authorizeDevice(c, device) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   device,
+	})
+}
+
+// GetDeviceResults returns a page of the speed test results of a device, newest first by default.
+// It accepts the limit, cursor and sort_order query parameters of /speed_test_result/list.
+func (ct *Controller) GetDeviceResults(c *gin.Context) {
+	var query struct {
+		SortOrder string `form:"sort_order"`
+		Limit     int    `form:"limit"`
+		Cursor    string `form:"cursor"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid query parameters",
+			Code: "INVALID_QUERY"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	device, err := ct.getDevice(ctx, c.Param("id"))
+	if err != nil {
+		ct.deviceError(c, "GetDeviceResults", err)
+		return
+	}
+	if !ct.authorizeDevice(c, device) {
+		return
+	}
+
+	results, nextCursor, err := ct.speedTRepo.Get(ctx, db.GetSpeedTestResultsFilter{
+		SpeedTestResultsFilter: db.SpeedTestResultsFilter{DeviceID: device.ID},
+		SortOrder:              query.SortOrder,
+		Limit:                  query.Limit,
+		Cursor:                 query.Cursor,
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidFilter) || errors.Is(err, db.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: err.Error(),
+				Code: "INVALID_FILTER"})
+			return
+		}
+
+		logger.FromContext(c.Request.Context()).Error("failed to retrieve speed test results", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status:     models.StatusSuccess,
+		Data:       results,
+		NextCursor: nextCursor,
+	})
+}
+
+func (ct *Controller) UpdateDevice(c *gin.Context) {
+	var requestBody models.UpdateDevice
+
+	if err := c.BindJSON(&requestBody); err != nil {
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
+			Code: "INVALID_BODY"})
+		return
+	}
+
+	if errs := validation.ValidateUpdateDevice(requestBody); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Invalid device",
+			Code:    "VALIDATION_ERROR",
+			Errors:  errs,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	device, err := ct.getDevice(ctx, c.Param("id"))
+	if err != nil {
+		ct.deviceError(c, "UpdateDevice", err)
+		return
+	}
+	if !ct.authorizeDevice(c, device) {
+		return
+	}
+
+	device, err = ct.devicesRepo.Update(ctx, device.ID, requestBody)
+	if err != nil {
+		ct.deviceError(c, "UpdateDevice", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   device,
+	})
+}
+
+// getDevice returns the device with id, or errUnknownDevice if there is none
+func (ct *Controller) getDevice(ctx context.Context, id string) (*models.Device, error) {
+	if !isUUID(id) {
+		return nil, errUnknownDevice
+	}
+
+	device, err := ct.devicesRepo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errUnknownDevice
+	}
+	return device, err
+}
+
+// authorizeDevice checks that a device linked to a user is accessed by that user or an admin,
+// writing the error response when it is not. Devices without a user are open to anyone.
+func (ct *Controller) authorizeDevice(c *gin.Context, device *models.Device) bool {
+	if device.UserID == nil {
+		return true
+	}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Bearer realm="sc-backend"`)
+		c.JSON(http.StatusUnauthorized, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Authentication required",
+			Code:    "UNAUTHORIZED",
+		})
+		return false
+	}
+	if userID != *device.UserID && !ct.isAdmin(c, userID) {
+		c.JSON(http.StatusForbidden, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Access to this device is not allowed",
+			Code:    "FORBIDDEN",
+		})
+		return false
+	}
+	return true
+}
+
+// isAdmin reports whether the authenticated user is an admin now, the role in their token may be
+// outdated
+func (ct *Controller) isAdmin(c *gin.Context, userID string) bool {
+	if middleware.Role(c) != models.RoleAdmin {
+		return false
+	}
+	user, err := ct.usersRepo.GetByID(c.Request.Context(), userID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.FromContext(c.Request.Context()).Error("user query failed", "error", err)
+		}
+		return false
+	}
+	return user.Role == models.RoleAdmin
+}
+
+// deviceError writes the response for an error returned while looking up a device
+func (ct *Controller) deviceError(c *gin.Context, handler string, err error) {
+	if errors.Is(err, errUnknownDevice) || errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Device not found",
+			Code:    "UNKNOWN_DEVICE",
+		})
+		return
+	}
+
+	logger.FromContext(c.Request.Context()).Error("device query failed", "handler", handler, "error", err)
+	c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+		Code: "INTERNAL_ERROR"})
+}
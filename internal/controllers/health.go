@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/checkspeed/sc-backend/internal/geo"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+// readinessCheckTimeout bounds each readiness check so a hung dependency fails the probe
+// instead of hanging it
+const readinessCheckTimeout = 3 * time.Second
+
+// geoProbeIP is looked up by the optional geolocation readiness check
+const geoProbeIP = "8.8.8.8"
+
+// geoProbeTTL is how long the outcome of the geolocation check is reused, so frequent probes
+// do not spend the api quota
+const geoProbeTTL = time.Minute
+
+// SetDraining marks the server as shutting down, readiness fails from then on so the
+// orchestrator stops routing new traffic to it
+func (ct *Controller) SetDraining() {
+	ct.draining.Store(true)
+}
+
+// Healthz reports that the process is up, it does not check any dependency
+func (ct *Controller) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   gin.H{"status": models.CheckOK},
+	})
+}
+
+// Readyz reports whether the server can handle traffic: the database answers, its schema is
+// at the latest migration and, when enabled, the geolocation api is reachable.
+// It responds with 503 when any check fails or graceful shutdown has started.
+func (ct *Controller) Readyz(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	readiness := models.Readiness{
+		Draining: ct.draining.Load(),
+		Checks: map[string]models.HealthCheck{
+			"database":   runCheck(ctx, ct.store.Ping),
+			"migrations": runCheck(ctx, ct.checkMigrations),
+		},
+	}
+	if ct.cfg.ReadinessGeoProbe {
+		readiness.Checks["geolocation"] = ct.geoProbeCheck(ctx)
+	}
+
+	readiness.Ready = !readiness.Draining
+	for name, check := range readiness.Checks {
+		if check.Status != models.CheckOK {
+			logger.FromContext(c.Request.Context()).Warn("readiness check failing", "check", name, "error", check.Error,
+				"duration", check.Duration)
+			readiness.Ready = false
+		}
+	}
+
+	if !readiness.Ready {
+		c.JSON(http.StatusServiceUnavailable, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Service not ready",
+			Code:    "NOT_READY",
+			Data:    readiness,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   readiness,
+	})
+}
+
+// runCheck runs check with readinessCheckTimeout and records its outcome
+func runCheck(ctx context.Context, check func(ctx context.Context) error) models.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := models.HealthCheck{
+		Status:   models.CheckOK,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		result.Status = models.CheckFailing
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// checkMigrations fails when the database is not at the newest migration shipped with the binary
+func (ct *Controller) checkMigrations(ctx context.Context) error {
+	latest, err := ct.migrator.LatestVersion()
+	if err != nil {
+		return err
+	}
+	version, dirty, err := ct.migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d failed part way", version)
+	}
+	// a newer schema is expected while a rolling deploy migrates ahead of the old instances
+	if version < latest {
+		return fmt.Errorf("database is at migration %d, expected %d", version, latest)
+	}
+	return nil
+}
+
+// geoProbeCheck runs the geolocation check at most once every geoProbeTTL and returns its last
+// outcome in between
+func (ct *Controller) geoProbeCheck(ctx context.Context) models.HealthCheck {
+	ct.geoProbeMu.Lock()
+	defer ct.geoProbeMu.Unlock()
+
+	if !ct.geoProbeAt.IsZero() && time.Since(ct.geoProbeAt) < geoProbeTTL {
+		return ct.geoProbe
+	}
+	ct.geoProbe = runCheck(ctx, ct.probeGeolocation)
+	ct.geoProbeAt = time.Now()
+	return ct.geoProbe
+}
+
+// probeGeolocation fails when none of the geolocation apis can locate geoProbeIP. The apis are
+// asked directly, as the local database and the cache would answer without asking them. Only the
+// local database is probed when no api is configured.
+func (ct *Controller) probeGeolocation(ctx context.Context) error {
+	var provider geo.Provider = ct.geo
+	if ct.remoteGeo != nil {
+		provider = ct.remoteGeo
+	}
+	_, err := provider.Lookup(ctx, netip.MustParseAddr(geoProbeIP))
+	return err
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/checkspeed/sc-backend/internal/db"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+const (
+	defaultLeaderboardWindowDays = 30
+	maxLeaderboardWindowDays     = 365
+	defaultLeaderboardMinSamples = 30
+)
+
+type ispLeaderboardQuery struct {
+	CountryCode string `form:"country_code"`
+	State       string `form:"state"`
+	Metric      string `form:"metric"`      // download_speed (default), upload_speed or latency
+	WindowDays  int    `form:"window_days"` // rolling window ending now
+	MinSamples  int    `form:"min_samples"` // ISPs with fewer results are left out
+}
+
+// GetISPLeaderboard ranks the ISPs of a country or state by the median of a metric over a rolling window
+func (ct *Controller) GetISPLeaderboard(c *gin.Context) {
+	var query ispLeaderboardQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid query parameters",
+			Code: "INVALID_QUERY"})
+		return
+	}
+
+	query.CountryCode = strings.TrimSpace(query.CountryCode)
+	if query.CountryCode == "" {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "country_code parameter is required",
+			Code:    "MISSING_COUNTRY_CODE",
+		})
+		return
+	}
+
+	if query.Metric == "" {
+		query.Metric = "download_speed"
+	}
+	if query.Metric != "download_speed" && query.Metric != "upload_speed" && query.Metric != "latency" {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "metric must be one of download_speed, upload_speed or latency",
+			Code:    "INVALID_METRIC",
+		})
+		return
+	}
+
+	if query.WindowDays <= 0 {
+		query.WindowDays = defaultLeaderboardWindowDays
+	}
+	if query.WindowDays > maxLeaderboardWindowDays {
+		query.WindowDays = maxLeaderboardWindowDays
+	}
+	if query.MinSamples <= 0 {
+		query.MinSamples = defaultLeaderboardMinSamples
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	windowStart := time.Now().UTC().AddDate(0, 0, -query.WindowDays)
+	stats, err := ct.speedTRepo.GetISPStats(ctx, db.SpeedTestResultsFilter{
+		CountryCode: query.CountryCode,
+		State:       query.State,
+		StartTime:   &windowStart,
+	}, query.MinSamples)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to retrieve isp stats", "error", err)
+
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	rankings := rankISPs(stats, query.Metric)
+
+	logger.FromContext(c.Request.Context()).Debug("isp leaderboard ranked",
+		"country_code", query.CountryCode,
+		"state", query.State,
+		"isps", len(rankings),
+	)
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   rankings,
+	})
+}
+
+// rankISPs orders stats by the median of metric, best first, using competition ranking for ties.
+// Higher is better for speeds and lower is better for latency.
+func rankISPs(stats []models.ISPStats, metric string) []models.ISPRanking {
+	median := func(s models.ISPStats) float64 {
+		switch metric {
+		case "upload_speed":
+			return s.UploadSpeed.Median
+		case "latency":
+			return -s.Latency.Median
+		default:
+			return s.DownloadSpeed.Median
+		}
+	}
+
+	sorted := make([]models.ISPStats, len(stats))
+	copy(sorted, stats)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if median(sorted[i]) != median(sorted[j]) {
+			return median(sorted[i]) > median(sorted[j])
+		}
+		// more samples first among ties so the order is stable across calls
+		if sorted[i].SampleCount != sorted[j].SampleCount {
+			return sorted[i].SampleCount > sorted[j].SampleCount
+		}
+		return sorted[i].ISP < sorted[j].ISP
+	})
+
+	rankings := make([]models.ISPRanking, len(sorted))
+	for i, s := range sorted {
+		rankings[i] = models.ISPRanking{Rank: i + 1, ISPStats: s}
+		if i > 0 && median(s) == median(sorted[i-1]) {
+			rankings[i].Rank = rankings[i-1].Rank
+			rankings[i].Tied = true
+			rankings[i-1].Tied = true
+		}
+	}
+
+	return rankings
+}
@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/checkspeed/sc-backend/internal/geo"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/checkspeed/sc-backend/internal/utils"
+	"github.com/checkspeed/sc-backend/internal/validation"
+)
+
+const (
+	defaultNearestTestServers = 5
+	maxNearestTestServers     = 50
+)
+
+var errUnknownTestServer = errors.New("unknown test server")
+
+func (ct *Controller) ListTestServers(c *gin.Context) {
+	ct.listTestServers(c, false)
+}
+
+// AdminListTestServers lists the test servers, soft deleted ones included with include_deleted=true
+func (ct *Controller) AdminListTestServers(c *gin.Context) {
+	ct.listTestServers(c, c.Query("include_deleted") == "true")
+}
+
+func (ct *Controller) listTestServers(c *gin.Context, includeDeleted bool) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	testServers, err := ct.testSrvRepo.List(ctx, includeDeleted)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to list test servers", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   testServers,
+	})
+}
+
+func (ct *Controller) GetTestServer(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	id := c.Param("id")
+	if !isUUID(id) {
+		ct.testServerError(c, "GetTestServer", gorm.ErrRecordNotFound)
+		return
+	}
+
+	testServer, err := ct.testSrvRepo.GetByID(ctx, id)
+	if err != nil {
+		ct.testServerError(c, "GetTestServer", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   testServer,
+	})
+}
+
+func (ct *Controller) CreateTestServer(c *gin.Context) {
+	var requestBody models.CreateTestServer
+
+	if err := c.BindJSON(&requestBody); err != nil {
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
+			Code: "INVALID_BODY"})
+		return
+	}
+
+	requestBody.Identifier = strings.TrimSpace(requestBody.Identifier)
+	requestBody.Country = strings.TrimSpace(requestBody.Country)
+	if requestBody.Identifier == "" || requestBody.Country == "" {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "identifier and country are required",
+			Code:    "MISSING_FIELDS",
+		})
+		return
+	}
+	if errs := validation.ValidateCreateTestServer(requestBody); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Invalid test server",
+			Code:    "VALIDATION_ERROR",
+			Errors:  errs,
+		})
+		return
+	}
+	if !validTestServerCoordinates(requestBody.Latitude, requestBody.Longitude) {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "latitude and longitude must be provided together and within range",
+			Code:    "INVALID_COORDINATES",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	testServer := models.TestServer{
+		ID:         uuid.NewString(),
+		Identifier: requestBody.Identifier,
+		Name:       strings.TrimSpace(requestBody.Name),
+		City:       strings.TrimSpace(requestBody.City),
+		Country:    requestBody.Country,
+		URL:        strings.TrimSpace(requestBody.URL),
+		Latitude:   requestBody.Latitude,
+		Longitude:  requestBody.Longitude,
+		IsActive:   true,
+	}
+	if err := ct.testSrvRepo.Create(ctx, testServer); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "A test server with this identifier already exists",
+				Code:    "DUPLICATE_TEST_SERVER",
+			})
+			return
+		}
+
+		logger.FromContext(c.Request.Context()).Error("failed to create test server", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   testServer,
+	})
+}
+
+func (ct *Controller) UpdateTestServer(c *gin.Context) {
+	var requestBody models.UpdateTestServer
+
+	if err := c.BindJSON(&requestBody); err != nil {
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
+			Code: "INVALID_BODY"})
+		return
+	}
+
+	if requestBody.Country != nil && strings.TrimSpace(*requestBody.Country) == "" {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "country must not be empty",
+			Code:    "MISSING_FIELDS",
+		})
+		return
+	}
+	if errs := validation.ValidateUpdateTestServer(requestBody); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Invalid test server",
+			Code:    "VALIDATION_ERROR",
+			Errors:  errs,
+		})
+		return
+	}
+	if !validTestServerCoordinates(requestBody.Latitude, requestBody.Longitude) {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "latitude and longitude must be provided together and within range",
+			Code:    "INVALID_COORDINATES",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	id := c.Param("id")
+	if !isUUID(id) {
+		ct.testServerError(c, "UpdateTestServer", gorm.ErrRecordNotFound)
+		return
+	}
+
+	testServer, err := ct.testSrvRepo.Update(ctx, id, requestBody)
+	if err != nil {
+		ct.testServerError(c, "UpdateTestServer", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   testServer,
+	})
+}
+
+func (ct *Controller) DeleteTestServer(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	id := c.Param("id")
+	if !isUUID(id) {
+		ct.testServerError(c, "DeleteTestServer", gorm.ErrRecordNotFound)
+		return
+	}
+
+	if err := ct.testSrvRepo.Delete(ctx, id); err != nil {
+		ct.testServerError(c, "DeleteTestServer", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status:  models.StatusSuccess,
+		Message: "Test server deleted",
+	})
+}
+
+// GetNearestTestServers returns the active test servers closest to the client, ordered by
+// great-circle distance. The client is located by the lat and lon query parameters, or else by
+// geolocating the ip parameter, falling back to the ip address of the request.
+func (ct *Controller) GetNearestTestServers(c *gin.Context) {
+	limit := defaultNearestTestServers
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "limit must be a positive number",
+				Code:    "INVALID_LIMIT",
+			})
+			return
+		}
+		limit = min(n, maxNearestTestServers)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	var lat, lon float64
+	if c.Query("lat") != "" || c.Query("lon") != "" {
+		var errLat, errLon error
+		lat, errLat = strconv.ParseFloat(c.Query("lat"), 64)
+		lon, errLon = strconv.ParseFloat(c.Query("lon"), 64)
+		if errLat != nil || errLon != nil || !utils.IsValidCoordinate(lat, lon) {
+			c.JSON(http.StatusBadRequest, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "lat and lon must be provided together and within range",
+				Code:    "INVALID_COORDINATES",
+			})
+			return
+		}
+	} else {
+		ipAddr := c.Query("ip")
+		if ipAddr == "" {
+			ipAddr = c.ClientIP()
+		}
+
+		info, err := ct.locateIP(ctx, ipAddr)
+		if err != nil && !errors.Is(err, geo.ErrNotFound) {
+			ct.geoError(c, ipAddr, err)
+			return
+		}
+		if err != nil || info.Latitude == nil || info.Longitude == nil {
+			c.JSON(http.StatusUnprocessableEntity, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "Unable to locate IP address, provide lat and lon instead",
+				Code:    "UNKNOWN_LOCATION",
+			})
+			return
+		}
+		lat, lon = *info.Latitude, *info.Longitude
+	}
+
+	testServers, err := ct.testSrvRepo.ListActive(ctx)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to list test servers", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	nearest := make([]models.NearestTestServer, 0, len(testServers))
+	for _, s := range testServers {
+		nearest = append(nearest, models.NearestTestServer{
+			TestServer: s,
+			DistanceKm: utils.DistanceKm(lat, lon, *s.Latitude, *s.Longitude),
+		})
+	}
+	sort.Slice(nearest, func(i, j int) bool {
+		return nearest[i].DistanceKm < nearest[j].DistanceKm
+	})
+	if len(nearest) > limit {
+		nearest = nearest[:limit]
+	}
+
+	logger.FromContext(c.Request.Context()).Debug("nearest test servers found", "latitude", lat, "longitude", lon, "count", len(nearest))
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   nearest,
+	})
+}
+
+// validTestServerCoordinates reports whether lat and lon are either both unset or both set and in range
+func validTestServerCoordinates(lat, lon *float64) bool {
+	if lat == nil || lon == nil {
+		return lat == nil && lon == nil
+	}
+	return utils.IsValidCoordinate(*lat, *lon)
+}
+
+// testServerError writes the response for an error returned by the test servers repo
+func (ct *Controller) testServerError(c *gin.Context, handler string, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Test server not found",
+			Code:    "NOT_FOUND",
+		})
+		return
+	}
+
+	logger.FromContext(c.Request.Context()).Error("test server query failed", "handler", handler, "error", err)
+	c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+		Code: "INTERNAL_ERROR"})
+}
+
+// resolveTestServerID links input to a registered test server, found by test_server_id, by
+// test_server_identifier or, for older clients, by a server_name matching an identifier. A
+// server_name matching none is ignored. Test servers are only registered through the admin
+// endpoints.
+func (ct *Controller) resolveTestServerID(ctx context.Context, input *models.CreateSpeedTestResult) error {
+	var (
+		testServer *models.TestServer
+		err        error
+	)
+	switch {
+	case input.TestServerID != "":
+		testServer, err = ct.testSrvRepo.GetByID(ctx, input.TestServerID)
+	case strings.TrimSpace(input.TestServerIdentifier) != "":
+		testServer, err = ct.testSrvRepo.GetByIdentifier(ctx, strings.TrimSpace(input.TestServerIdentifier))
+	case strings.TrimSpace(input.ServerName) != "":
+		testServer, err = ct.testSrvRepo.GetByIdentifier(ctx, strings.TrimSpace(input.ServerName))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+	default:
+		return nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errUnknownTestServer
+	}
+	if err != nil {
+		return err
+	}
+
+	input.TestServerID = testServer.ID
+	return nil
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/checkspeed/sc-backend/internal/auth"
+	"github.com/checkspeed/sc-backend/internal/db"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/checkspeed/sc-backend/internal/validation"
+)
+
+// dummyPasswordHash is compared against when logging in with an unknown email, so the
+// response time does not reveal which emails are registered
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("checkspeed-dummy-password"), bcrypt.DefaultCost)
+
+func (ct *Controller) RegisterUser(c *gin.Context) {
+	var requestBody models.CreateUser
+
+	if err := c.BindJSON(&requestBody); err != nil {
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
+			Code: "INVALID_BODY"})
+		return
+	}
+
+	if errs := validation.ValidateCreateUser(requestBody); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Invalid user",
+			Code:    "VALIDATION_ERROR",
+			Errors:  errs,
+		})
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(requestBody.Password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to hash password", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	user := models.User{
+		ID:           uuid.NewString(),
+		Username:     strings.TrimSpace(requestBody.Username),
+		Email:        strings.ToLower(strings.TrimSpace(requestBody.Email)),
+		PasswordHash: string(passwordHash),
+	}
+	if _, err := ct.usersRepo.GetByEmail(ctx, user.Email); err == nil {
+		ct.userExists(c)
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.FromContext(c.Request.Context()).Error("user query failed", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	if err := ct.usersRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			ct.userExists(c)
+			return
+		}
+
+		logger.FromContext(c.Request.Context()).Error("failed to create user", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	created, err := ct.usersRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to load created user", "error", err)
+		created = &user
+	}
+
+	c.JSON(http.StatusCreated, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   created,
+	})
+}
+
+func (ct *Controller) LoginUser(c *gin.Context) {
+	var requestBody models.LoginUser
+
+	if err := c.BindJSON(&requestBody); err != nil {
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
+			Code: "INVALID_BODY"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	user, err := ct.usersRepo.GetByEmail(ctx, strings.TrimSpace(requestBody.Email))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.FromContext(c.Request.Context()).Error("user query failed", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	passwordHash := dummyPasswordHash
+	if user != nil && user.PasswordHash != "" {
+		passwordHash = []byte(user.PasswordHash)
+	}
+	// always compare, even when the user is unknown
+	errCompare := bcrypt.CompareHashAndPassword(passwordHash, []byte(requestBody.Password))
+	if user == nil || user.PasswordHash == "" || errCompare != nil {
+		c.JSON(http.StatusUnauthorized, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "Invalid email or password",
+			Code:    "INVALID_CREDENTIALS",
+		})
+		return
+	}
+
+	token, expiresAt, err := ct.tokens.Issue(user.ID, user.Role)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to issue token", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data: models.AuthToken{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresAt:   expiresAt,
+			User:        user,
+		},
+	})
+}
+
+// ListUserDevices returns the devices linked to a user
+func (ct *Controller) ListUserDevices(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	user, err := ct.getUser(ctx, c.Param("id"))
+	if err != nil {
+		ct.userError(c, "ListUserDevices", err)
+		return
+	}
+
+	devices, err := ct.devicesRepo.ListByUserID(ctx, user.ID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to list devices", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   devices,
+	})
+}
+
+// LinkUserDevice links a device to a user with the secret issued when the device was created, a
+// device can only belong to one user
+func (ct *Controller) LinkUserDevice(c *gin.Context) {
+	var requestBody models.LinkDevice
+
+	if err := c.BindJSON(&requestBody); err != nil {
+		logger.FromContext(c.Request.Context()).Info("invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid request body",
+			Code: "INVALID_BODY"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	user, err := ct.getUser(ctx, c.Param("id"))
+	if err != nil {
+		ct.userError(c, "LinkUserDevice", err)
+		return
+	}
+
+	if !isUUID(requestBody.DeviceID) {
+		ct.deviceError(c, "LinkUserDevice", errUnknownDevice)
+		return
+	}
+
+	// only the client holding the device knows the secret issued when it was created
+	err = ct.devicesRepo.LinkUser(ctx, requestBody.DeviceID, user.ID, auth.HashDeviceSecret(requestBody.DeviceSecret))
+	if err != nil {
+		if errors.Is(err, db.ErrDeviceSecret) {
+			c.JSON(http.StatusForbidden, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "device_secret does not match the secret issued with the device",
+				Code:    "INVALID_DEVICE_SECRET",
+			})
+			return
+		}
+		if errors.Is(err, db.ErrDeviceLinked) {
+			c.JSON(http.StatusConflict, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "Device is linked to another user",
+				Code:    "DEVICE_ALREADY_LINKED",
+			})
+			return
+		}
+
+		ct.deviceError(c, "LinkUserDevice", err)
+		return
+	}
+
+	device, err := ct.devicesRepo.GetByID(ctx, requestBody.DeviceID)
+	if err != nil {
+		ct.deviceError(c, "LinkUserDevice", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status: models.StatusSuccess,
+		Data:   device,
+	})
+}
+
+// GetUserResults returns a page of the speed test results of all devices linked to a user,
+// newest first by default. It accepts the same query parameters as GetDeviceResults.
+func (ct *Controller) GetUserResults(c *gin.Context) {
+	var query struct {
+		SortOrder string `form:"sort_order"`
+		Limit     int    `form:"limit"`
+		Cursor    string `form:"cursor"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: "Invalid query parameters",
+			Code: "INVALID_QUERY"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	user, err := ct.getUser(ctx, c.Param("id"))
+	if err != nil {
+		ct.userError(c, "GetUserResults", err)
+		return
+	}
+
+	results, nextCursor, err := ct.speedTRepo.Get(ctx, db.GetSpeedTestResultsFilter{
+		SpeedTestResultsFilter: db.SpeedTestResultsFilter{UserID: user.ID},
+		SortOrder:              query.SortOrder,
+		Limit:                  query.Limit,
+		Cursor:                 query.Cursor,
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidFilter) || errors.Is(err, db.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, models.ApiResp{Status: models.StatusFail, Message: err.Error(),
+				Code: "INVALID_FILTER"})
+			return
+		}
+
+		logger.FromContext(c.Request.Context()).Error("failed to retrieve speed test results", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+			Code: "INTERNAL_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResp{
+		Status:     models.StatusSuccess,
+		Data:       results,
+		NextCursor: nextCursor,
+	})
+}
+
+// getUser returns the user with id, or gorm.ErrRecordNotFound if there is none
+func (ct *Controller) getUser(ctx context.Context, id string) (*models.User, error) {
+	if !isUUID(id) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return ct.usersRepo.GetByID(ctx, id)
+}
+
+// userError writes the response for an error returned while looking up a user
+func (ct *Controller) userError(c *gin.Context, handler string, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, models.ApiResp{
+			Status:  models.StatusFail,
+			Message: "User not found",
+			Code:    "NOT_FOUND",
+		})
+		return
+	}
+
+	logger.FromContext(c.Request.Context()).Error("user query failed", "handler", handler, "error", err)
+	c.JSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError, Message: "Internal server error",
+		Code: "INTERNAL_ERROR"})
+}
+
+func (ct *Controller) userExists(c *gin.Context) {
+	c.JSON(http.StatusConflict, models.ApiResp{
+		Status:  models.StatusFail,
+		Message: "A user with this username or email already exists",
+		Code:    "USER_EXISTS",
+	})
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+
+	_ "github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+type APIKeys interface {
+	Create(ctx context.Context, apiKey models.APIKey) error
+	GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	List(ctx context.Context) ([]models.APIKey, error)
+	// Revoke soft deletes the key, it is rejected from then on
+	Revoke(ctx context.Context, id string) error
+}
+
+type apiKeys struct {
+	db *gorm.DB
+}
+
+func NewAPIKeysRepo(store Store) (*apiKeys, error) {
+	return &apiKeys{
+		db: store.DB(),
+	}, nil
+}
+
+func (a *apiKeys) Create(ctx context.Context, apiKey models.APIKey) error {
+	return a.db.
+		WithContext(ctx).
+		Model(&models.APIKey{}).
+		Create(&apiKey).Error
+}
+
+func (a *apiKeys) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	resp := a.db.WithContext(ctx).
+		Where("key_hash = ?", keyHash).
+		Take(&apiKey)
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return &apiKey, nil
+}
+
+func (a *apiKeys) List(ctx context.Context) ([]models.APIKey, error) {
+	var apiKeys []models.APIKey
+
+	resp := a.db.WithContext(ctx).Order("created_at").Find(&apiKeys)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return apiKeys, nil
+}
+
+func (a *apiKeys) Revoke(ctx context.Context, id string) error {
+	resp := a.db.WithContext(ctx).
+		Where("id = ?", id).
+		Delete(&models.APIKey{})
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_APIKeys(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewAPIKeysRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	apiKey, err := auth.NewAPIKey("Acme ISP", 5000)
+	require.NoError(t, err)
+
+	t.Run("OK - create and get by hash", func(t *testing.T) {
+		err := repo.Create(ctx, apiKey.APIKey)
+		require.NoError(t, err)
+
+		dbKey, err := repo.GetByHash(ctx, auth.HashAPIKey(apiKey.Key))
+		require.NoError(t, err)
+		assert.Equal(t, apiKey.ID, dbKey.ID)
+		assert.Equal(t, 5000, dbKey.DailyQuota)
+	})
+
+	t.Run("OK - revoked key is not found", func(t *testing.T) {
+		err := repo.Revoke(ctx, apiKey.ID)
+		require.NoError(t, err)
+
+		_, err = repo.GetByHash(ctx, apiKey.KeyHash)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		err = repo.Revoke(ctx, apiKey.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+}
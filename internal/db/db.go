@@ -2,7 +2,7 @@ package db
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
 
 	_ "embed"
 
@@ -11,6 +11,9 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	gPostgres "gorm.io/driver/postgres"
 	"gorm.io/gorm"
+
+	"github.com/checkspeed/sc-backend/internal/metrics"
+	"github.com/checkspeed/sc-backend/internal/telemetry"
 )
 
 type store struct {
@@ -20,15 +23,27 @@ type store struct {
 type Store interface {
 	CloseConn(ctx context.Context) error
 	DB() *gorm.DB
+	// Ping checks that the database connection is still alive
+	Ping(ctx context.Context) error
 }
 
 func NewStore(dbUrl string) (*store, error) {
-	db, err := gorm.Open(gPostgres.Open(dbUrl), &gorm.Config{})
+	db, err := gorm.Open(gPostgres.Open(dbUrl), &gorm.Config{
+		// report constraint violations as gorm errors, e.g. gorm.ErrDuplicatedKey
+		TranslateError: true,
+	})
 	if err != nil {
 		return &store{}, err
 	}
 
-	fmt.Println("database connected")
+	if err := metrics.RegisterGORM(db); err != nil {
+		return &store{}, err
+	}
+	if err := telemetry.RegisterGORM(db); err != nil {
+		return &store{}, err
+	}
+
+	slog.Info("database connected")
 
 	return &store{db}, nil
 }
@@ -44,3 +59,11 @@ func (s store) CloseConn(ctx context.Context) error {
 	}
 	return db.Close()
 }
+
+func (s *store) Ping(ctx context.Context) error {
+	db, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.PingContext(ctx)
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 
 	// "github.com/google/uuid"
 	_ "github.com/lib/pq"
@@ -10,11 +11,23 @@ import (
 	"github.com/checkspeed/sc-backend/internal/models"
 )
 
+var (
+	ErrDeviceLinked = errors.New("device is linked to another user")
+	// ErrDeviceSecret is returned when linking a device with a secret other than the one issued with it
+	ErrDeviceSecret = errors.New("invalid device secret")
+)
+
 type Devices interface {
 	GetOrCreate(ctx context.Context, device models.Device) (string, int64, error)
 	GetIDByIdentifier(ctx context.Context, identifier string) (string, error)
 	Create(ctx context.Context, device models.Device) error
 	GetByID(ctx context.Context, id string) (*models.Device, error)
+	Update(ctx context.Context, id string, updates models.UpdateDevice) (*models.Device, error)
+	// LinkUser sets the owner of a device that has none. secretHash is the hash of the secret
+	// issued with the device, it returns ErrDeviceSecret when it does not match and
+	// ErrDeviceLinked when the device already belongs to another user.
+	LinkUser(ctx context.Context, id string, userID string, secretHash string) error
+	ListByUserID(ctx context.Context, userID string) ([]models.Device, error)
 }
 
 type devices struct {
@@ -73,3 +86,78 @@ func (d *devices) Create(ctx context.Context, device models.Device) error {
 		Model(&models.Device{}).
 		Create(&device).Error
 }
+
+func (d *devices) Update(ctx context.Context, id string, updates models.UpdateDevice) (*models.Device, error) {
+	fields := make(map[string]any)
+	if updates.OS != nil {
+		fields["os"] = *updates.OS
+	}
+	if updates.DeviceType != nil {
+		fields["device_type"] = *updates.DeviceType
+	}
+	if updates.Manufacturer != nil {
+		fields["manufacturer"] = *updates.Manufacturer
+	}
+	if updates.Model != nil {
+		fields["model"] = *updates.Model
+	}
+	if updates.ScreenResolution != nil {
+		fields["screen_resolution"] = *updates.ScreenResolution
+	}
+
+	device, err := d.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return device, nil
+	}
+
+	resp := d.db.WithContext(ctx).
+		Model(device).
+		Updates(fields)
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return d.GetByID(ctx, id)
+}
+
+func (d *devices) LinkUser(ctx context.Context, id string, userID string, secretHash string) error {
+	resp := d.db.WithContext(ctx).
+		Model(&models.Device{}).
+		Where("id = ? AND secret_hash = ? AND (user_id IS NULL OR user_id = ?)", id, secretHash, userID).
+		Update("user_id", userID)
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.RowsAffected > 0 {
+		return nil
+	}
+
+	// nothing was updated, the device does not exist, the secret is wrong or it has another owner
+	device, err := d.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if device.SecretHash == nil || *device.SecretHash != secretHash {
+		return ErrDeviceSecret
+	}
+	return ErrDeviceLinked
+}
+
+func (d *devices) ListByUserID(ctx context.Context, userID string) ([]models.Device, error) {
+	var devices []models.Device
+	resp := d.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&devices)
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return devices, nil
+}
@@ -182,3 +182,30 @@ func Test_GetIDByIdentifier(t *testing.T) {
 // 		assert.NoError(t, err)
 // 	})
 // }
+
+func Test_UpdateDevice(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewDevicesRepo(store)
+	require.NoError(t, err)
+
+	t.Run("OK - update metadata", func(t *testing.T) {
+		ctx := context.Background()
+
+		testDevice := models.Device{
+			ID:         uuid.NewString(),
+			Identifier: "update_device_identifier",
+			OS:         "Android",
+			DeviceType: "Mobile",
+		}
+		err := repo.Create(ctx, testDevice)
+		require.NoError(t, err)
+
+		model := "Pixel 8"
+		dbDevice, err := repo.Update(ctx, testDevice.ID, models.UpdateDevice{Model: &model})
+		require.NoError(t, err)
+		assert.Equal(t, model, dbDevice.Model)
+		assert.Equal(t, testDevice.OS, dbDevice.OS)
+	})
+}
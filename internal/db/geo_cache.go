@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+// GeoCache keeps located addresses in the database, so the geolocation cache is shared by all
+// instances of the server and survives restarts
+type GeoCache interface {
+	// Get returns the unexpired entry of prefix, ok is false when there is none
+	Get(ctx context.Context, prefix string) (info models.GeoInfo, ok bool, err error)
+	// Put stores info as the entry of prefix for ttl, replacing the previous one
+	Put(ctx context.Context, prefix string, info models.GeoInfo, ttl time.Duration) error
+	// DeleteExpired deletes the expired entries
+	DeleteExpired(ctx context.Context) error
+}
+
+type geoCache struct {
+	db *gorm.DB
+}
+
+func NewGeoCacheRepo(store Store) (*geoCache, error) {
+	return &geoCache{
+		db: store.DB(),
+	}, nil
+}
+
+func (g *geoCache) Get(ctx context.Context, prefix string) (models.GeoInfo, bool, error) {
+	var rows []string
+	err := g.db.WithContext(ctx).
+		Raw(`SELECT info FROM geo_cache WHERE prefix = ? AND expires_at > now()`, prefix).
+		Scan(&rows).Error
+	if err != nil {
+		return models.GeoInfo{}, false, err
+	}
+	if len(rows) == 0 {
+		return models.GeoInfo{}, false, nil
+	}
+
+	var info models.GeoInfo
+	if err := json.Unmarshal([]byte(rows[0]), &info); err != nil {
+		return models.GeoInfo{}, false, err
+	}
+	return info, true, nil
+}
+
+func (g *geoCache) Put(ctx context.Context, prefix string, info models.GeoInfo, ttl time.Duration) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	// expiry is computed by the database so instances with skewed clocks agree on it
+	return g.db.WithContext(ctx).Exec(`INSERT INTO geo_cache (prefix, info, expires_at)
+		VALUES (?, ?, now() + make_interval(secs => ?))
+		ON CONFLICT (prefix) DO UPDATE SET info = EXCLUDED.info, expires_at = EXCLUDED.expires_at, created_at = now()`,
+		prefix, string(data), ttl.Seconds()).Error
+}
+
+func (g *geoCache) DeleteExpired(ctx context.Context) error {
+	return g.db.WithContext(ctx).Exec(`DELETE FROM geo_cache WHERE expires_at <= now()`).Error
+}
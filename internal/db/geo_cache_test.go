@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+func Test_GeoCache(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewGeoCacheRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	latitude := 37.4224
+	info := models.GeoInfo{
+		IP:          "8.8.8.8",
+		ISP:         "Google LLC",
+		ASN:         15169,
+		CountryCode: "US",
+		City:        "Mountain View",
+		Latitude:    &latitude,
+		Provider:    "geojs",
+	}
+
+	t.Run("OK - put and get", func(t *testing.T) {
+		_, ok, err := repo.Get(ctx, "8.8.8.0/24")
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		err = repo.Put(ctx, "8.8.8.0/24", info, time.Hour)
+		require.NoError(t, err)
+
+		got, ok, err := repo.Get(ctx, "8.8.8.0/24")
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, info, got)
+
+		// a new lookup replaces the entry
+		info.City = "Palo Alto"
+		err = repo.Put(ctx, "8.8.8.0/24", info, time.Hour)
+		require.NoError(t, err)
+
+		got, ok, err = repo.Get(ctx, "8.8.8.0/24")
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, "Palo Alto", got.City)
+	})
+
+	t.Run("OK - expired entries are ignored and deleted", func(t *testing.T) {
+		err := repo.Put(ctx, "1.1.1.1/32", info, -time.Second)
+		require.NoError(t, err)
+
+		_, ok, err := repo.Get(ctx, "1.1.1.1/32")
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		err = repo.DeleteExpired(ctx)
+		require.NoError(t, err)
+
+		var prefixes []string
+		err = store.DB().Raw(`SELECT prefix FROM geo_cache`).Scan(&prefixes).Error
+		require.NoError(t, err)
+		assert.NotContains(t, prefixes, "1.1.1.1/32")
+		assert.Contains(t, prefixes, "8.8.8.0/24")
+	})
+}
@@ -3,18 +3,26 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 
-	_ "embed"
+	"embed"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
 type migrator struct {
 	db *sql.DB
 }
@@ -22,6 +30,10 @@ type migrator struct {
 type Migrator interface {
 	Up(ctx context.Context, migrationsPaths ...string) error
 	Down(ctx context.Context, migrationsPaths ...string) error
+	// Version returns the version of the last applied migration and whether it failed part way
+	Version(ctx context.Context) (uint, bool, error)
+	// LatestVersion returns the version of the newest migration in the migrations folder
+	LatestVersion(migrationsPaths ...string) (uint, error)
 }
 
 func NewMigrator(store Store) (*migrator, error) {
@@ -55,7 +67,7 @@ func (m *migrator) Up(ctx context.Context, migrationsPaths ...string) error {
 		return fmt.Errorf("failed to run up migration: %v", err)
 	}
 
-	fmt.Println("database migrated up")
+	slog.Info("database migrated up")
 	return nil
 }
 
@@ -79,10 +91,65 @@ func (m *migrator) Down(ctx context.Context, migrationsPaths ...string) error {
 		return fmt.Errorf("failed to run down migration: %v", err)
 	}
 
-	fmt.Println("database migrated down")
+	slog.Info("database migrated down")
 	return nil
 }
 
+func (m *migrator) Version(ctx context.Context) (uint, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+
+	// read the table directly so checking the version never creates or locks it
+	err := m.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read migration version: %v", err)
+	}
+
+	return uint(version), dirty, nil
+}
+
+func (m *migrator) LatestVersion(migrationsPaths ...string) (uint, error) {
+	var (
+		src source.Driver
+		err error
+	)
+	if len(migrationsPaths) > 0 && migrationsPaths[0] != "" {
+		var migrationsURL string
+		migrationsURL, err = m.constructMigrationPath(migrationsPaths...)
+		if err != nil {
+			return 0, err
+		}
+		src, err = source.Open(migrationsURL)
+	} else {
+		// the binary may run without the migrations folder next to it, so the embedded copy is used
+		src, err = iofs.New(migrationFiles, "migrations")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open migrations: %v", err)
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %v", err)
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read migrations: %v", err)
+		}
+		version = next
+	}
+}
+
 func (m *migrator) constructMigrationPath(migrationsPaths ...string) (string, error) {
 	var migrationsPath string
 
@@ -90,7 +157,7 @@ func (m *migrator) constructMigrationPath(migrationsPaths ...string) (string, er
 		migrationsPath = migrationsPaths[0]
 	}
 
-	fmt.Println("mig path", migrationsPath)
+	slog.Debug("migrations path", "path", migrationsPath)
 	if migrationsPath == "" {
 		_, testFilePath, _, _ := runtime.Caller(0)
 		testDir := filepath.Dir(testFilePath)
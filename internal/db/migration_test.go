@@ -29,6 +29,17 @@ func Test_Migration(t *testing.T) {
 		err = migrator.Up(ctx)
 		assert.NoError(t, err)
 	})
+
+	t.Run("version is latest after up migration", func(t *testing.T) {
+		migrator, err := NewMigrator(store)
+		require.NoError(t, err)
+		latest, err := migrator.LatestVersion()
+		require.NoError(t, err)
+		version, dirty, err := migrator.Version(ctx)
+		require.NoError(t, err)
+		assert.False(t, dirty)
+		assert.Equal(t, latest, version)
+	})
 }
 
 func Test_RunManualUpMigration(t *testing.T) {
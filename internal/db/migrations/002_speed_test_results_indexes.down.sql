@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_speed_test_results_device_id;
+
+DROP INDEX IF EXISTS idx_speed_test_results_isp_code;
+
+DROP INDEX IF EXISTS idx_speed_test_results_country_test_time;
+
+DROP INDEX IF EXISTS idx_speed_test_results_test_time;
@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS idx_speed_test_results_test_time ON speed_test_results (test_time, id);
+
+CREATE INDEX IF NOT EXISTS idx_speed_test_results_country_test_time ON speed_test_results (country_code, test_time, id);
+
+CREATE INDEX IF NOT EXISTS idx_speed_test_results_isp_code ON speed_test_results (isp_code);
+
+CREATE INDEX IF NOT EXISTS idx_speed_test_results_device_id ON speed_test_results (device_id);
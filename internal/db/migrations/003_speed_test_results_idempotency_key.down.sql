@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_speed_test_results_idempotency_key;
+
+ALTER TABLE speed_test_results DROP COLUMN IF EXISTS idempotency_key;
@@ -0,0 +1,3 @@
+ALTER TABLE speed_test_results ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(100) DEFAULT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_speed_test_results_idempotency_key ON speed_test_results (idempotency_key);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_speed_test_results_test_server_id;
+
+ALTER TABLE speed_test_results DROP COLUMN IF EXISTS test_server_id;
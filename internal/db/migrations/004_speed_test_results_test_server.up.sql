@@ -0,0 +1,3 @@
+ALTER TABLE speed_test_results ADD COLUMN IF NOT EXISTS test_server_id UUID DEFAULT NULL REFERENCES test_servers(id);
+
+CREATE INDEX IF NOT EXISTS idx_speed_test_results_test_server_id ON speed_test_results (test_server_id);
@@ -0,0 +1,5 @@
+ALTER TABLE test_servers DROP COLUMN IF EXISTS is_active;
+
+ALTER TABLE test_servers DROP COLUMN IF EXISTS longitude;
+
+ALTER TABLE test_servers DROP COLUMN IF EXISTS latitude;
@@ -0,0 +1,5 @@
+ALTER TABLE test_servers ADD COLUMN IF NOT EXISTS latitude DECIMAL DEFAULT NULL;
+
+ALTER TABLE test_servers ADD COLUMN IF NOT EXISTS longitude DECIMAL DEFAULT NULL;
+
+ALTER TABLE test_servers ADD COLUMN IF NOT EXISTS is_active BOOLEAN DEFAULT TRUE NOT NULL;
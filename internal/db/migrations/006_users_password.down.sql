@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_devices_user_id;
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_hash;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash VARCHAR(100) DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices (user_id);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key VARCHAR(200) NOT NULL PRIMARY KEY,
+
+    tokens DOUBLE PRECISION NOT NULL,
+    burst INT NOT NULL,
+    refill_rate DOUBLE PRECISION NOT NULL,
+
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
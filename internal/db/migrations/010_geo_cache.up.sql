@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS geo_cache (
+    prefix VARCHAR(50) NOT NULL PRIMARY KEY,
+
+    info JSONB NOT NULL,
+
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_geo_cache_expires_at ON geo_cache (expires_at);
@@ -0,0 +1,14 @@
+-- keys reused by several devices are only unique again once the later results drop theirs, the
+-- results themselves are kept
+UPDATE speed_test_results r
+SET idempotency_key = NULL
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY idempotency_key ORDER BY created_at, id) AS rn
+    FROM speed_test_results
+    WHERE idempotency_key IS NOT NULL
+) d
+WHERE r.id = d.id AND d.rn > 1;
+
+DROP INDEX IF EXISTS idx_speed_test_results_device_idempotency_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_speed_test_results_idempotency_key ON speed_test_results (idempotency_key);
@@ -0,0 +1,4 @@
+-- idempotency keys are chosen by clients, they only identify a retry within the device that sent it
+DROP INDEX IF EXISTS idx_speed_test_results_idempotency_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_speed_test_results_device_idempotency_key ON speed_test_results (device_id, idempotency_key);
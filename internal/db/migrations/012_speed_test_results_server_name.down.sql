@@ -0,0 +1,10 @@
+ALTER TABLE speed_test_results ADD COLUMN IF NOT EXISTS server_name VARCHAR(50);
+
+-- the names and links from before the up migration are restored, results stored since have no server_name
+UPDATE speed_test_results r
+SET server_name = n.server_name,
+    test_server_id = CASE WHEN n.linked THEN NULL ELSE r.test_server_id END
+FROM speed_test_results_server_names n
+WHERE r.id = n.result_id;
+
+DROP TABLE IF EXISTS speed_test_results_server_names;
@@ -0,0 +1,23 @@
+-- server_name was free text, it is replaced by the test_server_id link. The names are kept aside,
+-- with whether this migration linked the result, so the down migration can restore them.
+CREATE TABLE IF NOT EXISTS speed_test_results_server_names (
+    result_id UUID NOT NULL PRIMARY KEY,
+    server_name VARCHAR(50) NOT NULL,
+    linked BOOLEAN NOT NULL
+);
+
+INSERT INTO speed_test_results_server_names (result_id, server_name, linked)
+SELECT r.id, r.server_name, r.test_server_id IS NULL AND s.id IS NOT NULL
+FROM speed_test_results r
+LEFT JOIN test_servers s ON s.deleted_at IS NULL AND s.identifier = trim(r.server_name)
+WHERE r.server_name IS NOT NULL AND r.server_name <> ''
+ON CONFLICT (result_id) DO NOTHING;
+
+-- results naming a registered server by its identifier are linked to it
+UPDATE speed_test_results r
+SET test_server_id = s.id
+FROM speed_test_results_server_names n, test_servers s
+WHERE r.id = n.result_id AND n.linked AND r.test_server_id IS NULL
+  AND s.deleted_at IS NULL AND s.identifier = trim(n.server_name);
+
+ALTER TABLE speed_test_results DROP COLUMN IF EXISTS server_name;
@@ -0,0 +1,9 @@
+-- deleted servers sharing their identifier with another server get a unique one, suffixed with their id
+UPDATE test_servers t
+SET identifier = left(t.identifier, 63) || '-' || t.id
+WHERE t.deleted_at IS NOT NULL
+  AND EXISTS (SELECT 1 FROM test_servers o WHERE o.identifier = t.identifier AND o.id <> t.id);
+
+DROP INDEX IF EXISTS idx_test_servers_identifier;
+
+ALTER TABLE test_servers ADD CONSTRAINT test_servers_identifier_key UNIQUE (identifier);
@@ -0,0 +1,4 @@
+-- identifiers only need to be unique among the servers in use, so a deleted server's identifier can be registered again
+ALTER TABLE test_servers DROP CONSTRAINT IF EXISTS test_servers_identifier_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_test_servers_identifier ON test_servers (identifier) WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+-- hash of the secret issued with a device, proving possession when it is linked to a user
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS secret_hash VARCHAR(64) DEFAULT NULL;
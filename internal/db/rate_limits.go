@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+// RateLimitBuckets keeps rate limiting token buckets in the database, so the limits hold
+// across all instances of the server
+type RateLimitBuckets interface {
+	// Take takes a token from the bucket of key refilling at refillRate tokens per second up to
+	// burst, and returns whether it was allowed and the tokens left
+	Take(ctx context.Context, key string, refillRate float64, burst int) (bool, float64, error)
+	// DeleteFull deletes the buckets that have refilled completely
+	DeleteFull(ctx context.Context) error
+}
+
+type rateLimitBucket struct {
+	Tokens  float64
+	Elapsed float64 // seconds since the bucket was last updated
+}
+
+type rateLimitBuckets struct {
+	db *gorm.DB
+}
+
+func NewRateLimitBucketsRepo(store Store) (*rateLimitBuckets, error) {
+	return &rateLimitBuckets{
+		db: store.DB(),
+	}, nil
+}
+
+func (r *rateLimitBuckets) Take(ctx context.Context, key string, refillRate float64, burst int) (bool, float64, error) {
+	var allowed bool
+	var tokens float64
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// new buckets start full
+		err := tx.Exec(`INSERT INTO rate_limit_buckets (key, tokens, burst, refill_rate, updated_at)
+			VALUES (?, ?, ?, ?, now()) ON CONFLICT (key) DO NOTHING`, key, burst, burst, refillRate).Error
+		if err != nil {
+			return err
+		}
+
+		// the row lock serialises concurrent requests of the same client across instances
+		var bucket rateLimitBucket
+		err = tx.Raw(`SELECT tokens, EXTRACT(EPOCH FROM now() - updated_at) AS elapsed
+			FROM rate_limit_buckets WHERE key = ? FOR UPDATE`, key).
+			Scan(&bucket).Error
+		if err != nil {
+			return err
+		}
+
+		tokens = math.Min(float64(burst), bucket.Tokens+math.Max(bucket.Elapsed, 0)*refillRate)
+		if tokens >= 1 {
+			allowed = true
+			tokens--
+		}
+
+		return tx.Exec(`UPDATE rate_limit_buckets SET tokens = ?, burst = ?, refill_rate = ?, updated_at = now()
+			WHERE key = ?`, tokens, burst, refillRate, key).Error
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	return allowed, tokens, nil
+}
+
+func (r *rateLimitBuckets) DeleteFull(ctx context.Context) error {
+	return r.db.WithContext(ctx).Exec(`DELETE FROM rate_limit_buckets
+		WHERE tokens + EXTRACT(EPOCH FROM now() - updated_at) * refill_rate >= burst`).Error
+}
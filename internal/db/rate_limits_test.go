@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RateLimitBuckets(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewRateLimitBucketsRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	// a token every hour, so the bucket does not refill during the test
+	refillRate := 1.0 / 3600
+
+	t.Run("OK - take until empty", func(t *testing.T) {
+		allowed, tokens, err := repo.Take(ctx, "test:192.168.1.1", refillRate, 2)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+		assert.InDelta(t, 1, tokens, 0.01)
+
+		allowed, _, err = repo.Take(ctx, "test:192.168.1.1", refillRate, 2)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+
+		allowed, tokens, err = repo.Take(ctx, "test:192.168.1.1", refillRate, 2)
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		assert.Less(t, tokens, 1.0)
+
+		// other keys have their own bucket
+		allowed, _, err = repo.Take(ctx, "test:192.168.1.2", refillRate, 2)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	})
+
+	t.Run("OK - full buckets are deleted", func(t *testing.T) {
+		// an instant refill makes the bucket full again
+		_, _, err := repo.Take(ctx, "test:192.168.1.3", 1e9, 1)
+		require.NoError(t, err)
+
+		err = repo.DeleteFull(ctx)
+		require.NoError(t, err)
+
+		var keys []string
+		err = store.DB().Raw(`SELECT key FROM rate_limit_buckets WHERE key LIKE 'test:%'`).Scan(&keys).Error
+		require.NoError(t, err)
+		assert.NotContains(t, keys, "test:192.168.1.3")
+		assert.Contains(t, keys, "test:192.168.1.1")
+	})
+}
@@ -2,10 +2,19 @@ package db
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // const (
@@ -13,13 +22,146 @@ import (
 // 	usersCollection           = "users"
 // )
 
+const (
+	defaultResultsLimit = 100
+	maxResultsLimit     = 1000
+	batchInsertSize     = 100
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid filter")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// sortableColumns maps the sort_by values accepted from clients to their columns
+var sortableColumns = map[string]string{
+	"test_time":      "test_time",
+	"created_at":     "created_at",
+	"download_speed": "download_speed",
+	"upload_speed":   "upload_speed",
+	"latency":        "latency",
+}
+
+// statsGroupExpressions maps the group_by values accepted from clients to the expression results are grouped by
+var statsGroupExpressions = map[string]string{
+	"country_code":    "COALESCE(country_code, '')",
+	"state":           "COALESCE(state, '')",
+	"isp":             "COALESCE(isp, '')",
+	"connection_type": "COALESCE(connection_type, '')",
+	"test_platform":   "COALESCE(test_platform, '')",
+	"test_server_id":  "COALESCE(test_server_id::text, '')",
+	"day":             "to_char(date_trunc('day', test_time), 'YYYY-MM-DD')",
+	"week":            "to_char(date_trunc('week', test_time), 'YYYY-MM-DD')",
+	"month":           "to_char(date_trunc('month', test_time), 'YYYY-MM')",
+}
+
+// SpeedTestResultsFilter holds the conditions used to narrow down speed test results.
+// Zero values are ignored.
+type SpeedTestResultsFilter struct {
+	CountryCode    string `json:"country_code"` // 3 letter country code
+	State          string `json:"state"`
+	ContinentCode  string `json:"continent_code"`
+	ISP            string `json:"isp"`
+	ISPCode        string `json:"isp_code"`
+	ConnectionType string `json:"connection_type"`
+	TestPlatform   string `json:"test_platform"`
+	TestServerID   string `json:"test_server_id"`
+	DeviceID       string `json:"device_id"`
+	UserID         string `json:"-"` // results of all devices linked to the user
+
+	// test_time range, StartTime is inclusive and EndTime is exclusive
+	StartTime *time.Time `json:"start_time"`
+	EndTime   *time.Time `json:"end_time"`
+
+	MinDownloadSpeed *int `json:"min_download_speed"` // kbps
+	MaxDownloadSpeed *int `json:"max_download_speed"` // kbps
+	MinUploadSpeed   *int `json:"min_upload_speed"`   // kbps
+	MaxUploadSpeed   *int `json:"max_upload_speed"`   // kbps
+	MinLatency       *int `json:"min_latency"`        // ms
+	MaxLatency       *int `json:"max_latency"`        // ms
+}
+
 type GetSpeedTestResultsFilter struct {
-	CountryCode string `json:"country_code"` // 3 letter country code
+	SpeedTestResultsFilter
+
+	SortBy    string `json:"sort_by"`    // test_time (default), created_at, download_speed, upload_speed or latency
+	SortOrder string `json:"sort_order"` // desc (default) or asc
+	Limit     int    `json:"limit"`      // defaults to 100, capped at 1000
+	Cursor    string `json:"cursor"`     // next_cursor returned by a previous call
+}
+
+type GetSpeedTestResultsStatsFilter struct {
+	SpeedTestResultsFilter
+
+	// GroupBy is one of country_code, state, isp, connection_type, test_platform, test_server_id, day, week or month
+	GroupBy string `json:"group_by"`
+}
+
+// statsRow is a single row of the stats query before it is split into per metric stats
+type statsRow struct {
+	GroupKey string
+	Count    int64
+
+	DownloadSpeedMean   float64
+	DownloadSpeedMedian float64
+	DownloadSpeedP10    float64
+	DownloadSpeedP90    float64
+	DownloadSpeedMax    float64
+
+	UploadSpeedMean   float64
+	UploadSpeedMedian float64
+	UploadSpeedP10    float64
+	UploadSpeedP90    float64
+	UploadSpeedMax    float64
+
+	LatencyMean   float64
+	LatencyMedian float64
+	LatencyP10    float64
+	LatencyP90    float64
+	LatencyMax    float64
+}
+
+// ispMetricRow holds the median of a single metric of an ISP
+type ispMetricRow struct {
+	ISP         string
+	ISPCode     string
+	Metric      string
+	SampleCount int64
+	Median      float64
+	CILower     float64 `gorm:"column:ci_lower"`
+	CIUpper     float64 `gorm:"column:ci_upper"`
+}
+
+// resultsCursor is the decoded form of the opaque pagination cursor.
+// It holds the sort key and id of the last result on the previous page.
+type resultsCursor struct {
+	SortBy    string `json:"s"`
+	SortOrder string `json:"o"`
+	Value     string `json:"v"`
+	ID        string `json:"id"`
 }
 
 type SpeedTestResults interface {
 	Create(ctx context.Context, speedTestResult *models.SpeedTestResults) error
-	Get(ctx context.Context, filters GetSpeedTestResultsFilter) ([]models.SpeedTestResults, error)
+	// CreateIdempotent stores speedTestResult unless its device already stored a result with the
+	// same idempotency key, in which case speedTestResult is replaced by the stored result and
+	// created is false
+	CreateIdempotent(ctx context.Context, speedTestResult *models.SpeedTestResults) (created bool, err error)
+	// CreateBatch stores speedTestResults in a single transaction, either all or none are stored.
+	// A result whose device already stored one with the same idempotency key is replaced by the
+	// stored result, created reports which results were inserted.
+	CreateBatch(ctx context.Context, speedTestResults []models.SpeedTestResults) (created []bool, err error)
+	// Get returns a page of results matching filters and the cursor of the next page, if any
+	Get(ctx context.Context, filters GetSpeedTestResultsFilter) ([]models.SpeedTestResults, string, error)
+	// GetStats returns aggregated download, upload and latency stats of results matching filters
+	GetStats(ctx context.Context, filters GetSpeedTestResultsStatsFilter) ([]models.SpeedTestResultStats, error)
+	// GetISPStats returns the median metrics of every ISP with at least minSamples results matching filters
+	GetISPStats(ctx context.Context, filters SpeedTestResultsFilter, minSamples int) ([]models.ISPStats, error)
+	// Delete removes a result for good, e.g. an abusive submission
+	Delete(ctx context.Context, id string) error
 }
 
 type speedTestResultsRepo struct {
@@ -41,20 +183,405 @@ func (s speedTestResultsRepo) Create(ctx context.Context, speedTestResult *model
 	return nil
 }
 
-func (s speedTestResultsRepo)  Get(ctx context.Context, filters GetSpeedTestResultsFilter) ([]models.SpeedTestResults, error) {
+func (s speedTestResultsRepo) CreateIdempotent(ctx context.Context, speedTestResult *models.SpeedTestResults) (bool, error) {
+	return createIdempotent(s.db.WithContext(ctx), speedTestResult)
+}
+
+func (s speedTestResultsRepo) CreateBatch(ctx context.Context, speedTestResults []models.SpeedTestResults) ([]bool, error) {
+	created := make([]bool, len(speedTestResults))
+	if len(speedTestResults) == 0 {
+		return created, nil
+	}
+
+	// rows are inserted one by one to learn which ones conflicted, a batch holds at most a few hundred
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range speedTestResults {
+			ok, err := createIdempotent(tx, &speedTestResults[i])
+			if err != nil {
+				return err
+			}
+			created[i] = ok
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// idempotencyConflict skips results whose device already stored a result with the same key,
+// the primary key is generated by the server and never conflicts
+var idempotencyConflict = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "device_id"}, {Name: "idempotency_key"}},
+	DoNothing: true,
+}
+
+func createIdempotent(tx *gorm.DB, speedTestResult *models.SpeedTestResults) (bool, error) {
+	result := tx.Clauses(idempotencyConflict).Create(speedTestResult)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	if speedTestResult.IdempotencyKey == nil {
+		return false, fmt.Errorf("speed test result %s was not stored", speedTestResult.ID)
+	}
+
+	// the insert conflicted, return the result stored by the earlier request of the same device
+	var existing models.SpeedTestResults
+	err := tx.Where("device_id = ? AND idempotency_key = ?", speedTestResult.DeviceID, *speedTestResult.IdempotencyKey).
+		Take(&existing).Error
+	if err != nil {
+		return false, err
+	}
+	*speedTestResult = existing
+
+	return false, nil
+}
+
+func (s speedTestResultsRepo) Get(ctx context.Context, filters GetSpeedTestResultsFilter) ([]models.SpeedTestResults, string, error) {
 	var speedTestResult []models.SpeedTestResults
 
-	query := s.db.WithContext(ctx)
+	sortBy := filters.SortBy
+	if sortBy == "" {
+		sortBy = "test_time"
+	}
+	sortColumn, ok := sortableColumns[sortBy]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: unsupported sort_by %q", ErrInvalidFilter, filters.SortBy)
+	}
+
+	sortOrder := filters.SortOrder
+	if sortOrder == "" {
+		sortOrder = SortDesc
+	}
+	if sortOrder != SortAsc && sortOrder != SortDesc {
+		return nil, "", fmt.Errorf("%w: unsupported sort_order %q", ErrInvalidFilter, filters.SortOrder)
+	}
+
+	limit := filters.Limit
+	if limit < 0 {
+		return nil, "", fmt.Errorf("%w: limit must not be negative", ErrInvalidFilter)
+	}
+	if limit == 0 {
+		limit = defaultResultsLimit
+	}
+	if limit > maxResultsLimit {
+		limit = maxResultsLimit
+	}
 
-	if filters.CountryCode != "" {
-		query = query.Where("country_code = ?", filters.CountryCode)
+	query, err := applyResultsFilter(s.db.WithContext(ctx), filters.SpeedTestResultsFilter)
+	if err != nil {
+		return nil, "", err
 	}
 
-	result := query.Find(&speedTestResult)
+	if filters.Cursor != "" {
+		cursor, err := decodeResultsCursor(filters.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if cursor.SortBy != sortBy || cursor.SortOrder != sortOrder {
+			return nil, "", fmt.Errorf("%w: cursor does not match sort_by and sort_order", ErrInvalidCursor)
+		}
+		value, err := parseCursorValue(sortBy, cursor.Value)
+		if err != nil {
+			return nil, "", err
+		}
+
+		op := "<"
+		if sortOrder == SortAsc {
+			op = ">"
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", sortColumn, op), value, cursor.ID)
+	}
+
+	// fetch one extra row to find out if there is a next page
+	result := query.
+		Order(fmt.Sprintf("%s %s, id %s", sortColumn, sortOrder, sortOrder)).
+		Limit(limit + 1).
+		Find(&speedTestResult)
+
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	var nextCursor string
+	if len(speedTestResult) > limit {
+		speedTestResult = speedTestResult[:limit]
+		last := speedTestResult[limit-1]
+		nextCursor = encodeResultsCursor(resultsCursor{
+			SortBy:    sortBy,
+			SortOrder: sortOrder,
+			Value:     cursorValue(sortBy, last),
+			ID:        last.ID,
+		})
+	}
+
+	return speedTestResult, nextCursor, nil
+}
+
+func (s speedTestResultsRepo) GetStats(ctx context.Context, filters GetSpeedTestResultsStatsFilter) ([]models.SpeedTestResultStats, error) {
+	groupExpr, ok := statsGroupExpressions[filters.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported group_by %q", ErrInvalidFilter, filters.GroupBy)
+	}
+
+	selects := []string{groupExpr + " AS group_key", "COUNT(*) AS count"}
+	for _, column := range []string{"download_speed", "upload_speed", "latency"} {
+		selects = append(selects,
+			fmt.Sprintf("AVG(%[1]s) AS %[1]s_mean", column),
+			fmt.Sprintf("percentile_cont(0.5) WITHIN GROUP (ORDER BY %[1]s) AS %[1]s_median", column),
+			fmt.Sprintf("percentile_cont(0.1) WITHIN GROUP (ORDER BY %[1]s) AS %[1]s_p10", column),
+			fmt.Sprintf("percentile_cont(0.9) WITHIN GROUP (ORDER BY %[1]s) AS %[1]s_p90", column),
+			fmt.Sprintf("MAX(%[1]s) AS %[1]s_max", column),
+		)
+	}
+
+	query, err := applyResultsFilter(s.db.WithContext(ctx).Model(&models.SpeedTestResults{}), filters.SpeedTestResultsFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []statsRow
+	result := query.
+		Select(strings.Join(selects, ", ")).
+		Group("group_key").
+		Order("group_key").
+		Scan(&rows)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	stats := make([]models.SpeedTestResultStats, 0, len(rows))
+	for _, row := range rows {
+		stats = append(stats, models.SpeedTestResultStats{
+			Group: row.GroupKey,
+			Count: row.Count,
+			DownloadSpeed: models.MetricStats{
+				Mean:   row.DownloadSpeedMean,
+				Median: row.DownloadSpeedMedian,
+				P10:    row.DownloadSpeedP10,
+				P90:    row.DownloadSpeedP90,
+				Max:    row.DownloadSpeedMax,
+			},
+			UploadSpeed: models.MetricStats{
+				Mean:   row.UploadSpeedMean,
+				Median: row.UploadSpeedMedian,
+				P10:    row.UploadSpeedP10,
+				P90:    row.UploadSpeedP90,
+				Max:    row.UploadSpeedMax,
+			},
+			Latency: models.MetricStats{
+				Mean:   row.LatencyMean,
+				Median: row.LatencyMedian,
+				P10:    row.LatencyP10,
+				P90:    row.LatencyP90,
+				Max:    row.LatencyMax,
+			},
+		})
+	}
+
+	return stats, nil
+}
+
+func (s speedTestResultsRepo) GetISPStats(ctx context.Context, filters SpeedTestResultsFilter, minSamples int) ([]models.ISPStats, error) {
+	// one row per result and metric so every metric can be ranked within its ISP, results
+	// without an ISP are not ranked
+	filtered, err := applyResultsFilter(s.db.Model(&models.SpeedTestResults{}), filters)
+	if err != nil {
+		return nil, err
+	}
+	samples := filtered.
+		Where("isp IS NOT NULL AND isp <> ''").
+		Select("isp, COALESCE(isp_code, '') AS isp_code, m.metric, m.value").
+		Joins("CROSS JOIN LATERAL (VALUES ('download_speed', download_speed), ('upload_speed', upload_speed), ('latency', latency)) AS m(metric, value)")
+
+	ranked := s.db.Table("(?) AS samples", samples).
+		Select(`isp, isp_code, metric, value,
+			ROW_NUMBER() OVER (PARTITION BY isp, isp_code, metric ORDER BY value) AS rn,
+			COUNT(*) OVER (PARTITION BY isp, isp_code, metric) AS n`)
+
+	// the confidence interval uses the order statistics around the median,
+	// ranks n/2 -+ 1.96*sqrt(n)/2, which needs no assumption about the distribution
+	var rows []ispMetricRow
+	result := s.db.WithContext(ctx).Table("(?) AS ranked", ranked).
+		Select(`isp, isp_code, metric, MAX(n) AS sample_count,
+			AVG(value) FILTER (WHERE rn IN ((n + 1) / 2, (n + 2) / 2)) AS median,
+			MAX(value) FILTER (WHERE rn = GREATEST(1, FLOOR(n / 2.0 - 0.98 * SQRT(n)))) AS ci_lower,
+			MAX(value) FILTER (WHERE rn = LEAST(n, CEIL(1 + n / 2.0 + 0.98 * SQRT(n)))) AS ci_upper`).
+		Where("n >= ?", minSamples).
+		Group("isp, isp_code, metric").
+		Order("isp, isp_code").
+		Scan(&rows)
 
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	return speedTestResult, nil
+	var stats []models.ISPStats
+	index := make(map[[2]string]int)
+	for _, row := range rows {
+		key := [2]string{row.ISP, row.ISPCode}
+		i, ok := index[key]
+		if !ok {
+			i = len(stats)
+			index[key] = i
+			stats = append(stats, models.ISPStats{ISP: row.ISP, ISPCode: row.ISPCode, SampleCount: row.SampleCount})
+		}
+
+		estimate := models.MedianEstimate{Median: row.Median, CILower: row.CILower, CIUpper: row.CIUpper}
+		switch row.Metric {
+		case "download_speed":
+			stats[i].DownloadSpeed = estimate
+		case "upload_speed":
+			stats[i].UploadSpeed = estimate
+		case "latency":
+			stats[i].Latency = estimate
+		}
+	}
+
+	return stats, nil
+}
+
+// applyResultsFilter adds the where clauses for every non zero field of filters to query. Ids
+// that are not UUIDs fail with ErrInvalidFilter rather than in the database.
+func applyResultsFilter(query *gorm.DB, filters SpeedTestResultsFilter) (*gorm.DB, error) {
+	ids := []struct {
+		name  string
+		value string
+	}{
+		{"test_server_id", filters.TestServerID},
+		{"device_id", filters.DeviceID},
+		{"user_id", filters.UserID},
+	}
+	for _, id := range ids {
+		if id.value == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id.value); err != nil {
+			return nil, fmt.Errorf("%w: %s must be a UUID", ErrInvalidFilter, id.name)
+		}
+	}
+
+	equals := []struct {
+		column string
+		value  string
+	}{
+		{"country_code", filters.CountryCode},
+		{"state", filters.State},
+		{"continent_code", filters.ContinentCode},
+		{"isp", filters.ISP},
+		{"isp_code", filters.ISPCode},
+		{"connection_type", filters.ConnectionType},
+		{"test_platform", filters.TestPlatform},
+		{"test_server_id", filters.TestServerID},
+		{"device_id", filters.DeviceID},
+	}
+	for _, f := range equals {
+		if f.value != "" {
+			query = query.Where(f.column+" = ?", f.value)
+		}
+	}
+
+	if filters.UserID != "" {
+		query = query.Where("device_id IN (SELECT id FROM devices WHERE user_id = ?)", filters.UserID)
+	}
+
+	if filters.StartTime != nil {
+		query = query.Where("test_time >= ?", filters.StartTime.UTC())
+	}
+	if filters.EndTime != nil {
+		query = query.Where("test_time < ?", filters.EndTime.UTC())
+	}
+
+	ranges := []struct {
+		condition string
+		value     *int
+	}{
+		{"download_speed >= ?", filters.MinDownloadSpeed},
+		{"download_speed <= ?", filters.MaxDownloadSpeed},
+		{"upload_speed >= ?", filters.MinUploadSpeed},
+		{"upload_speed <= ?", filters.MaxUploadSpeed},
+		{"latency >= ?", filters.MinLatency},
+		{"latency <= ?", filters.MaxLatency},
+	}
+	for _, r := range ranges {
+		if r.value != nil {
+			query = query.Where(r.condition, *r.value)
+		}
+	}
+
+	return query, nil
+}
+
+func encodeResultsCursor(c resultsCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeResultsCursor(s string) (resultsCursor, error) {
+	var c resultsCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return c, ErrInvalidCursor
+	}
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// cursorValue returns the sort key of result as stored in a cursor
+func cursorValue(sortBy string, result models.SpeedTestResults) string {
+	switch sortBy {
+	case "created_at":
+		return result.CreatedAt.Format(time.RFC3339Nano)
+	case "download_speed":
+		return strconv.Itoa(result.DownloadSpeed)
+	case "upload_speed":
+		return strconv.Itoa(result.UploadSpeed)
+	case "latency":
+		return strconv.Itoa(result.Latency)
+	default:
+		return result.TestTime.Format(time.RFC3339Nano)
+	}
+}
+
+// parseCursorValue converts a cursor sort key back to the type of its column
+func parseCursorValue(sortBy, value string) (any, error) {
+	switch sortBy {
+	case "test_time", "created_at":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return t, nil
+	default:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return n, nil
+	}
+}
+
+func (s speedTestResultsRepo) Delete(ctx context.Context, id string) error {
+	resp := s.db.WithContext(ctx).
+		Where("id = ?", id).
+		Delete(&models.SpeedTestResults{})
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
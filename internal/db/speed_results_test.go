@@ -1,5 +1,17 @@
 package db
 
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
 // import (
 // 	"context"
 // 	"fmt"
@@ -55,3 +67,294 @@ package db
 // 	assert.NoError(t, err)
 // 	fmt.Println(resp)
 // }
+
+func Test_GetSpeedTestResults(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewSpeedTestResultsRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	baseTime := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		err := repo.Create(ctx, &models.SpeedTestResults{
+			ID:            uuid.NewString(),
+			DownloadSpeed: 10000 * (i + 1),
+			UploadSpeed:   5000,
+			Latency:       20 + i,
+			ISPCode:       "PAGETEST",
+			CountryCode:   "NG",
+			TestTime:      baseTime.Add(time.Duration(i) * time.Hour),
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("OK - paginate with cursor", func(t *testing.T) {
+		filters := GetSpeedTestResultsFilter{
+			SpeedTestResultsFilter: SpeedTestResultsFilter{ISPCode: "PAGETEST"},
+			Limit:                  2,
+		}
+
+		var seen []models.SpeedTestResults
+		for {
+			results, nextCursor, err := repo.Get(ctx, filters)
+			require.NoError(t, err)
+			seen = append(seen, results...)
+			if nextCursor == "" {
+				break
+			}
+			filters.Cursor = nextCursor
+		}
+
+		require.Len(t, seen, 5)
+		for i := 1; i < len(seen); i++ {
+			assert.True(t, seen[i-1].TestTime.After(seen[i].TestTime))
+		}
+	})
+
+	t.Run("OK - range filters and ascending sort", func(t *testing.T) {
+		minDownload := 20000
+		maxLatency := 23
+		results, nextCursor, err := repo.Get(ctx, GetSpeedTestResultsFilter{
+			SpeedTestResultsFilter: SpeedTestResultsFilter{
+				ISPCode:          "PAGETEST",
+				MinDownloadSpeed: &minDownload,
+				MaxLatency:       &maxLatency,
+			},
+			SortBy:    "download_speed",
+			SortOrder: SortAsc,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, nextCursor)
+		require.Len(t, results, 3)
+		assert.Equal(t, 20000, results[0].DownloadSpeed)
+		assert.Equal(t, 40000, results[2].DownloadSpeed)
+	})
+
+	t.Run("Fail - cursor from a different sort", func(t *testing.T) {
+		filters := GetSpeedTestResultsFilter{
+			SpeedTestResultsFilter: SpeedTestResultsFilter{ISPCode: "PAGETEST"},
+			Limit:                  1,
+		}
+		_, nextCursor, err := repo.Get(ctx, filters)
+		require.NoError(t, err)
+
+		filters.Cursor = nextCursor
+		filters.SortBy = "latency"
+		_, _, err = repo.Get(ctx, filters)
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("Fail - cursor id is not a UUID", func(t *testing.T) {
+		cursor := encodeResultsCursor(resultsCursor{SortBy: "test_time", SortOrder: SortDesc, Value: time.Now().Format(time.RFC3339Nano), ID: "1"})
+		_, _, err := repo.Get(ctx, GetSpeedTestResultsFilter{Cursor: cursor})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("Fail - ids are not UUIDs", func(t *testing.T) {
+		for _, filter := range []SpeedTestResultsFilter{{DeviceID: "abc"}, {TestServerID: "abc"}, {UserID: "abc"}} {
+			_, _, err := repo.Get(ctx, GetSpeedTestResultsFilter{SpeedTestResultsFilter: filter})
+			assert.ErrorIs(t, err, ErrInvalidFilter)
+		}
+	})
+}
+
+func Test_GetSpeedTestResultsStats(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewSpeedTestResultsRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for i, connectionType := range []string{"wifi", "wifi", "wifi", "4g"} {
+		err := repo.Create(ctx, &models.SpeedTestResults{
+			ID:             uuid.NewString(),
+			DownloadSpeed:  10000 * (i + 1),
+			UploadSpeed:    1000 * (i + 1),
+			Latency:        10 * (i + 1),
+			ISPCode:        "STATSTEST",
+			ConnectionType: connectionType,
+			TestTime:       time.Now(),
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("OK - group by connection type", func(t *testing.T) {
+		stats, err := repo.GetStats(ctx, GetSpeedTestResultsStatsFilter{
+			SpeedTestResultsFilter: SpeedTestResultsFilter{ISPCode: "STATSTEST"},
+			GroupBy:                "connection_type",
+		})
+		require.NoError(t, err)
+		require.Len(t, stats, 2)
+
+		assert.Equal(t, "4g", stats[0].Group)
+		assert.Equal(t, int64(1), stats[0].Count)
+
+		assert.Equal(t, "wifi", stats[1].Group)
+		assert.Equal(t, int64(3), stats[1].Count)
+		assert.Equal(t, float64(20000), stats[1].DownloadSpeed.Mean)
+		assert.Equal(t, float64(20000), stats[1].DownloadSpeed.Median)
+		assert.Equal(t, float64(30000), stats[1].DownloadSpeed.Max)
+		assert.Equal(t, float64(30), stats[1].Latency.Max)
+	})
+
+	t.Run("Fail - unsupported group by", func(t *testing.T) {
+		_, err := repo.GetStats(ctx, GetSpeedTestResultsStatsFilter{GroupBy: "device_id"})
+		assert.ErrorIs(t, err, ErrInvalidFilter)
+	})
+}
+
+func Test_GetISPStats(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewSpeedTestResultsRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	isps := map[string]int{"ISP_A": 5, "ISP_B": 2}
+	for isp, count := range isps {
+		for i := 0; i < count; i++ {
+			err := repo.Create(ctx, &models.SpeedTestResults{
+				ID:            uuid.NewString(),
+				DownloadSpeed: 1000 * (i + 1),
+				UploadSpeed:   100 * (i + 1),
+				Latency:       10 * (i + 1),
+				ISP:           isp,
+				ISPCode:       isp,
+				CountryCode:   "GH",
+				TestTime:      time.Now(),
+				CreatedAt:     time.Now(),
+				UpdatedAt:     time.Now(),
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	// results without an ISP are not ranked as an ISP named ""
+	for i := 0; i < 5; i++ {
+		err := repo.Create(ctx, &models.SpeedTestResults{
+			ID:            uuid.NewString(),
+			DownloadSpeed: 1000,
+			UploadSpeed:   100,
+			Latency:       10,
+			CountryCode:   "GH",
+			TestTime:      time.Now(),
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("OK - ISPs below min samples are left out", func(t *testing.T) {
+		stats, err := repo.GetISPStats(ctx, SpeedTestResultsFilter{CountryCode: "GH"}, 3)
+		require.NoError(t, err)
+		require.Len(t, stats, 1)
+
+		assert.Equal(t, "ISP_A", stats[0].ISP)
+		assert.Equal(t, int64(5), stats[0].SampleCount)
+		assert.Equal(t, float64(3000), stats[0].DownloadSpeed.Median)
+		assert.Equal(t, float64(30), stats[0].Latency.Median)
+		assert.LessOrEqual(t, stats[0].DownloadSpeed.CILower, stats[0].DownloadSpeed.Median)
+		assert.GreaterOrEqual(t, stats[0].DownloadSpeed.CIUpper, stats[0].DownloadSpeed.Median)
+	})
+}
+
+func Test_DeleteSpeedTestResult(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewSpeedTestResultsRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	result := models.SpeedTestResults{
+		ID:            uuid.NewString(),
+		DownloadSpeed: 10000,
+		UploadSpeed:   5000,
+		Latency:       20,
+		ISPCode:       "DELETETEST",
+		TestTime:      time.Now(),
+	}
+	require.NoError(t, repo.Create(ctx, &result))
+
+	err = repo.Delete(ctx, result.ID)
+	require.NoError(t, err)
+
+	results, _, err := repo.Get(ctx, GetSpeedTestResultsFilter{
+		SpeedTestResultsFilter: SpeedTestResultsFilter{ISPCode: "DELETETEST"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	err = repo.Delete(ctx, result.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func Test_CreateIdempotent(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewSpeedTestResultsRepo(store)
+	require.NoError(t, err)
+	devicesRepo, err := NewDevicesRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var deviceIDs []string
+	for _, identifier := range []string{"idempotent_device_a", "idempotent_device_b"} {
+		device := models.Device{ID: uuid.NewString(), Identifier: identifier, OS: "Android", DeviceType: "Mobile"}
+		require.NoError(t, devicesRepo.Create(ctx, device))
+		deviceIDs = append(deviceIDs, device.ID)
+	}
+
+	newResult := func(deviceID, key string) models.SpeedTestResults {
+		return models.SpeedTestResults{
+			ID:             uuid.NewString(),
+			IdempotencyKey: &key,
+			DeviceID:       deviceID,
+			DownloadSpeed:  1000,
+			Latency:        10,
+			TestTime:       time.Now(),
+		}
+	}
+
+	t.Run("OK - retries of a device are replayed", func(t *testing.T) {
+		first := newResult(deviceIDs[0], "key-1")
+		created, err := repo.CreateIdempotent(ctx, &first)
+		require.NoError(t, err)
+		assert.True(t, created)
+
+		retry := newResult(deviceIDs[0], "key-1")
+		created, err = repo.CreateIdempotent(ctx, &retry)
+		require.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, first.ID, retry.ID)
+	})
+
+	t.Run("OK - keys are scoped to the device", func(t *testing.T) {
+		other := newResult(deviceIDs[1], "key-1")
+		created, err := repo.CreateIdempotent(ctx, &other)
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, deviceIDs[1], other.DeviceID)
+	})
+
+	t.Run("OK - batch reports the skipped results", func(t *testing.T) {
+		results := []models.SpeedTestResults{
+			newResult(deviceIDs[0], "key-1"),
+			newResult(deviceIDs[0], "key-2"),
+			newResult(deviceIDs[0], "key-2"),
+		}
+		created, err := repo.CreateBatch(ctx, results)
+		require.NoError(t, err)
+		assert.Equal(t, []bool{false, true, false}, created)
+		assert.Equal(t, results[1].ID, results[2].ID)
+	})
+}
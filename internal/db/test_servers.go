@@ -11,6 +11,17 @@ import (
 
 type TestServers interface {
 	GetOrCreate(ctx context.Context, device models.TestServer) (string, int64, error)
+	Create(ctx context.Context, testServer models.TestServer) error
+	GetByID(ctx context.Context, id string) (*models.TestServer, error)
+	// GetByIdentifier returns the test server with the identifier, soft deleted ones are not found
+	GetByIdentifier(ctx context.Context, identifier string) (*models.TestServer, error)
+	// List returns all test servers ordered by name, soft deleted ones are only included when includeDeleted is set
+	List(ctx context.Context, includeDeleted bool) ([]models.TestServer, error)
+	// ListActive returns the active test servers that have coordinates
+	ListActive(ctx context.Context) ([]models.TestServer, error)
+	Update(ctx context.Context, id string, updates models.UpdateTestServer) (*models.TestServer, error)
+	// Delete soft deletes the test server, results linked to it are kept
+	Delete(ctx context.Context, id string) error
 }
 
 type testServers struct {
@@ -37,3 +48,123 @@ func (d *testServers) GetOrCreate(ctx context.Context, testServer models.TestSer
 
 	return testServer.ID, resp.RowsAffected, nil
 }
+
+func (d *testServers) Create(ctx context.Context, testServer models.TestServer) error {
+	return d.db.
+		WithContext(ctx).
+		Model(&models.TestServer{}).
+		Create(&testServer).Error
+}
+
+func (d *testServers) GetByID(ctx context.Context, id string) (*models.TestServer, error) {
+	var testServer models.TestServer
+	resp := d.db.WithContext(ctx).
+		Where("id = ?", id).
+		Take(&testServer)
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return &testServer, nil
+}
+
+func (d *testServers) GetByIdentifier(ctx context.Context, identifier string) (*models.TestServer, error) {
+	var testServer models.TestServer
+	resp := d.db.WithContext(ctx).
+		Where("identifier = ?", identifier).
+		Take(&testServer)
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return &testServer, nil
+}
+
+func (d *testServers) List(ctx context.Context, includeDeleted bool) ([]models.TestServer, error) {
+	var testServers []models.TestServer
+
+	query := d.db.WithContext(ctx)
+	if includeDeleted {
+		query = query.Unscoped()
+	}
+
+	resp := query.Order("name, identifier").Find(&testServers)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return testServers, nil
+}
+
+func (d *testServers) ListActive(ctx context.Context) ([]models.TestServer, error) {
+	var testServers []models.TestServer
+
+	resp := d.db.WithContext(ctx).
+		Where("is_active AND latitude IS NOT NULL AND longitude IS NOT NULL").
+		Find(&testServers)
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return testServers, nil
+}
+
+func (d *testServers) Update(ctx context.Context, id string, updates models.UpdateTestServer) (*models.TestServer, error) {
+	fields := make(map[string]any)
+	if updates.Name != nil {
+		fields["name"] = *updates.Name
+	}
+	if updates.City != nil {
+		fields["city"] = *updates.City
+	}
+	if updates.Country != nil {
+		fields["country"] = *updates.Country
+	}
+	if updates.URL != nil {
+		fields["url"] = *updates.URL
+	}
+	if updates.Latitude != nil {
+		fields["latitude"] = *updates.Latitude
+	}
+	if updates.Longitude != nil {
+		fields["longitude"] = *updates.Longitude
+	}
+	if updates.IsActive != nil {
+		fields["is_active"] = *updates.IsActive
+	}
+
+	testServer, err := d.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return testServer, nil
+	}
+
+	resp := d.db.WithContext(ctx).
+		Model(testServer).
+		Updates(fields)
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return d.GetByID(ctx, id)
+}
+
+func (d *testServers) Delete(ctx context.Context, id string) error {
+	resp := d.db.WithContext(ctx).
+		Where("id = ?", id).
+		Delete(&models.TestServer{})
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
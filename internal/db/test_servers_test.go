@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_TestServers(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewTestServerRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	testServer := models.TestServer{
+		ID:         uuid.NewString(),
+		Identifier: "lagos-1",
+		Name:       "Lagos 1",
+		City:       "Lagos",
+		Country:    "NG",
+		URL:        "https://lagos-1.example.com",
+	}
+
+	t.Run("OK - create and update", func(t *testing.T) {
+		err := repo.Create(ctx, testServer)
+		require.NoError(t, err)
+
+		name := "Lagos One"
+		updated, err := repo.Update(ctx, testServer.ID, models.UpdateTestServer{Name: &name})
+		require.NoError(t, err)
+		assert.Equal(t, name, updated.Name)
+		assert.Equal(t, testServer.URL, updated.URL)
+
+		found, err := repo.GetByIdentifier(ctx, testServer.Identifier)
+		require.NoError(t, err)
+		assert.Equal(t, testServer.ID, found.ID)
+	})
+
+	t.Run("Fail - duplicate identifier", func(t *testing.T) {
+		duplicate := testServer
+		duplicate.ID = uuid.NewString()
+		err := repo.Create(ctx, duplicate)
+		assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+	})
+
+	t.Run("OK - soft delete", func(t *testing.T) {
+		err := repo.Delete(ctx, testServer.ID)
+		require.NoError(t, err)
+
+		_, err = repo.GetByID(ctx, testServer.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		_, err = repo.GetByIdentifier(ctx, testServer.Identifier)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		all, err := repo.List(ctx, true)
+		require.NoError(t, err)
+		var found bool
+		for _, s := range all {
+			found = found || s.ID == testServer.ID
+		}
+		assert.True(t, found)
+	})
+
+	t.Run("OK - identifier of a deleted server is registered again", func(t *testing.T) {
+		replacement := testServer
+		replacement.ID = uuid.NewString()
+		err := repo.Create(ctx, replacement)
+		require.NoError(t, err)
+
+		found, err := repo.GetByIdentifier(ctx, testServer.Identifier)
+		require.NoError(t, err)
+		assert.Equal(t, replacement.ID, found.ID)
+	})
+}
+
+func Test_ListActiveTestServers(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewTestServerRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	lat, lon := 6.5244, 3.3792
+	located := models.TestServer{ID: uuid.NewString(), Identifier: "located-1", Country: "NG", Latitude: &lat, Longitude: &lon, IsActive: true}
+	unlocated := models.TestServer{ID: uuid.NewString(), Identifier: "unlocated-1", Country: "NG", IsActive: true}
+	inactive := models.TestServer{ID: uuid.NewString(), Identifier: "inactive-1", Country: "NG", Latitude: &lat, Longitude: &lon, IsActive: true}
+	for _, s := range []models.TestServer{located, unlocated, inactive} {
+		require.NoError(t, repo.Create(ctx, s))
+	}
+	isActive := false
+	_, err = repo.Update(ctx, inactive.ID, models.UpdateTestServer{IsActive: &isActive})
+	require.NoError(t, err)
+
+	active, err := repo.ListActive(ctx)
+	require.NoError(t, err)
+
+	ids := make(map[string]bool)
+	for _, s := range active {
+		ids[s.ID] = true
+	}
+	assert.True(t, ids[located.ID])
+	assert.False(t, ids[unlocated.ID])
+	assert.False(t, ids[inactive.ID])
+}
@@ -1 +1,76 @@
 package db
+
+import (
+	"context"
+
+	_ "github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+type Users interface {
+	Create(ctx context.Context, user models.User) error
+	GetByID(ctx context.Context, id string) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	SetRole(ctx context.Context, id string, role string) error
+}
+
+type users struct {
+	db *gorm.DB
+}
+
+func NewUsersRepo(store Store) (*users, error) {
+	return &users{
+		db: store.DB(),
+	}, nil
+}
+
+func (u *users) Create(ctx context.Context, user models.User) error {
+	return u.db.
+		WithContext(ctx).
+		Model(&models.User{}).
+		Create(&user).Error
+}
+
+func (u *users) GetByID(ctx context.Context, id string) (*models.User, error) {
+	var user models.User
+	resp := u.db.WithContext(ctx).
+		Where("id = ?", id).
+		Take(&user)
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return &user, nil
+}
+
+// GetByEmail returns the user with email, emails are compared case insensitively
+func (u *users) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	resp := u.db.WithContext(ctx).
+		Where("LOWER(email) = LOWER(?)", email).
+		Take(&user)
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return &user, nil
+}
+
+func (u *users) SetRole(ctx context.Context, id string, role string) error {
+	resp := u.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", id).
+		Update("role", role)
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
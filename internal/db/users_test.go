@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_Users(t *testing.T) {
+	store, err := NewStore(databaseUrl)
+	require.NoError(t, err)
+
+	repo, err := NewUsersRepo(store)
+	require.NoError(t, err)
+
+	devicesRepo, err := NewDevicesRepo(store)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	user := models.User{
+		ID:           uuid.NewString(),
+		Username:     "ada",
+		Email:        "ada@example.com",
+		PasswordHash: "hash",
+	}
+
+	t.Run("OK - create and get by email", func(t *testing.T) {
+		err := repo.Create(ctx, user)
+		require.NoError(t, err)
+
+		dbUser, err := repo.GetByEmail(ctx, "Ada@Example.com")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, dbUser.ID)
+		assert.Equal(t, user.PasswordHash, dbUser.PasswordHash)
+	})
+
+	t.Run("Fail - duplicate email", func(t *testing.T) {
+		duplicate := user
+		duplicate.ID = uuid.NewString()
+		duplicate.Username = "ada2"
+		err := repo.Create(ctx, duplicate)
+		assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+	})
+
+	t.Run("OK - link devices", func(t *testing.T) {
+		secretHash := "5f1e0c5b2c8e4d3a"
+		device := models.Device{
+			ID:         uuid.NewString(),
+			Identifier: "user_device_identifier",
+			OS:         "Android",
+			DeviceType: "Mobile",
+			SecretHash: &secretHash,
+		}
+		err := devicesRepo.Create(ctx, device)
+		require.NoError(t, err)
+
+		err = devicesRepo.LinkUser(ctx, device.ID, user.ID, "wrong")
+		assert.ErrorIs(t, err, ErrDeviceSecret)
+
+		err = devicesRepo.LinkUser(ctx, device.ID, user.ID, secretHash)
+		require.NoError(t, err)
+
+		// linking again to the same user is a no-op
+		err = devicesRepo.LinkUser(ctx, device.ID, user.ID, secretHash)
+		require.NoError(t, err)
+
+		devices, err := devicesRepo.ListByUserID(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, devices, 1)
+		assert.Equal(t, device.ID, devices[0].ID)
+
+		other := models.User{ID: uuid.NewString(), Username: "grace", Email: "grace@example.com"}
+		require.NoError(t, repo.Create(ctx, other))
+		err = devicesRepo.LinkUser(ctx, device.ID, other.ID, secretHash)
+		assert.ErrorIs(t, err, ErrDeviceLinked)
+
+		err = devicesRepo.LinkUser(ctx, uuid.NewString(), user.ID, secretHash)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+}
@@ -0,0 +1,242 @@
+package geo
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/metrics"
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+// Cache tiers, as labelled in the cache metrics
+const (
+	cacheTierMemory     = "memory"
+	cacheTierPersistent = "persistent"
+)
+
+// cacheLookupTimeout bounds a lookup shared by concurrent callers, it is not cancelled with the
+// request that started it as the other callers are still waiting for it
+const cacheLookupTimeout = 15 * time.Second
+
+// CacheStore is a persistent tier of the cache shared by all instances, see db.GeoCache
+type CacheStore interface {
+	// Get returns the unexpired entry of prefix, ok is false when there is none
+	Get(ctx context.Context, prefix string) (info models.GeoInfo, ok bool, err error)
+	// Put stores info as the entry of prefix for ttl, replacing the previous one
+	Put(ctx context.Context, prefix string, info models.GeoInfo, ttl time.Duration) error
+	// DeleteExpired deletes the expired entries
+	DeleteExpired(ctx context.Context) error
+}
+
+// Cache remembers the answers of a provider by network prefix. Entries are kept in memory in
+// least recently used order, so the oldest can be evicted when the cache is full.
+type Cache struct {
+	next  Provider
+	store CacheStore
+	cfg   config.GeoCache
+
+	// lookups deduplicates the concurrent lookups of a prefix
+	lookups singleflight.Group
+
+	mu      sync.Mutex
+	entries map[netip.Prefix]*list.Element
+	lru     *list.List // front is the most recently used
+}
+
+type cacheEntry struct {
+	prefix  netip.Prefix
+	info    models.GeoInfo
+	err     error // ErrNotFound for the prefixes next could not locate
+	expires time.Time
+}
+
+// NewCache returns a provider caching the answers of next as configured by cfg. store is the
+// persistent tier asked on memory misses, nil to cache in memory only. Addresses next cannot
+// locate are only cached in memory.
+func NewCache(next Provider, cfg config.GeoCache, store CacheStore) *Cache {
+	return &Cache{
+		next:    next,
+		store:   store,
+		cfg:     cfg,
+		entries: make(map[netip.Prefix]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (c *Cache) Name() string {
+	return "cache"
+}
+
+// Lookup returns the cached answer for the prefix of ip, or asks the persistent tier and then
+// next. Concurrent lookups of a prefix share a single request to next.
+func (c *Cache) Lookup(ctx context.Context, ip netip.Addr) (models.GeoInfo, error) {
+	ip = ip.Unmap()
+	prefix := c.prefix(ip)
+
+	if entry, ok := c.get(prefix); ok {
+		metrics.GeoCacheLookup(cacheTierMemory, true)
+		return withIP(entry.info, ip), entry.err
+	}
+	metrics.GeoCacheLookup(cacheTierMemory, false)
+
+	result := c.lookups.DoChan(prefix.String(), func() (any, error) {
+		lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheLookupTimeout)
+		defer cancel()
+		return c.load(lookupCtx, prefix, ip)
+	})
+	select {
+	case <-ctx.Done():
+		return models.GeoInfo{}, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return models.GeoInfo{}, res.Err
+		}
+		return withIP(res.Val.(models.GeoInfo), ip), nil
+	}
+}
+
+// load fills the memory entry of prefix from the persistent tier or next. The persistent tier is
+// skipped when it fails, lookups then go to next.
+func (c *Cache) load(ctx context.Context, prefix netip.Prefix, ip netip.Addr) (models.GeoInfo, error) {
+	if c.store != nil {
+		info, ok, err := c.store.Get(ctx, prefix.String())
+		if err != nil {
+			logger.FromContext(ctx).Warn("geolocation cache store lookup failed", "error", err)
+		} else {
+			metrics.GeoCacheLookup(cacheTierPersistent, ok)
+			if ok {
+				c.set(prefix, info, nil, c.cfg.TTL)
+				return info, nil
+			}
+		}
+	}
+
+	info, err := c.next.Lookup(ctx, ip)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) && c.cfg.NotFoundTTL > 0 {
+			c.set(prefix, models.GeoInfo{}, ErrNotFound, c.cfg.NotFoundTTL)
+		}
+		return models.GeoInfo{}, err
+	}
+
+	c.set(prefix, info, nil, c.cfg.TTL)
+	if c.store != nil {
+		if err := c.store.Put(ctx, prefix.String(), info, c.cfg.TTL); err != nil {
+			logger.FromContext(ctx).Warn("geolocation cache store update failed", "error", err)
+		}
+	}
+	return info, nil
+}
+
+// prefix returns the network sharing the cache entry of ip
+func (c *Cache) prefix(ip netip.Addr) netip.Prefix {
+	bits := c.cfg.IPv6PrefixLen
+	if ip.Is4() {
+		bits = c.cfg.IPv4PrefixLen
+	}
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		// invalid lengths cache the address alone
+		return netip.PrefixFrom(ip, ip.BitLen())
+	}
+	return prefix
+}
+
+// get returns the unexpired entry of prefix. Entries are replaced rather than updated, so the
+// returned one can be read without the lock.
+func (c *Cache) get(prefix netip.Prefix) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[prefix]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, prefix)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+func (c *Cache) set(prefix netip.Prefix, info models.GeoInfo, err error, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{prefix: prefix, info: info, err: err, expires: time.Now().Add(ttl)}
+	if elem, ok := c.entries[prefix]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	if c.cfg.MaxEntries > 0 && c.lru.Len() >= c.cfg.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).prefix)
+	}
+	c.entries[prefix] = c.lru.PushFront(entry)
+}
+
+// Len returns the number of entries held in memory, expired ones included until the next cleanup
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Cleanup removes the expired entries from memory and from the persistent tier
+func (c *Cache) Cleanup(ctx context.Context) error {
+	c.mu.Lock()
+	now := time.Now()
+	for elem := c.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if entry := elem.Value.(*cacheEntry); !now.Before(entry.expires) {
+			c.lru.Remove(elem)
+			delete(c.entries, entry.prefix)
+		}
+		elem = prev
+	}
+	c.mu.Unlock()
+
+	if c.store == nil {
+		return nil
+	}
+	return c.store.DeleteExpired(ctx)
+}
+
+// Run cleans up the expired entries every cleanup interval until ctx is done
+func (c *Cache) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("geolocation cache cleanup failed", "error", err)
+			}
+		}
+	}
+}
+
+// withIP returns info as the answer for ip, entries being shared by the addresses of a prefix
+func withIP(info models.GeoInfo, ip netip.Addr) models.GeoInfo {
+	if info.IP != "" {
+		info.IP = ip.String()
+	}
+	return info
+}
@@ -0,0 +1,221 @@
+package geo_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/geo"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCacheConfig = config.GeoCache{
+	TTL:             time.Hour,
+	NotFoundTTL:     time.Hour,
+	MaxEntries:      100,
+	IPv4PrefixLen:   24,
+	IPv6PrefixLen:   64,
+	CleanupInterval: time.Minute,
+}
+
+// blockingProvider holds its lookups until release is closed
+type blockingProvider struct {
+	release chan struct{}
+	lookups atomic.Int32
+}
+
+func (p *blockingProvider) Name() string {
+	return "blocking"
+}
+
+func (p *blockingProvider) Lookup(ctx context.Context, ip netip.Addr) (models.GeoInfo, error) {
+	p.lookups.Add(1)
+	<-p.release
+	return models.GeoInfo{IP: ip.String(), CountryCode: "US"}, nil
+}
+
+// memoryStore is a CacheStore in a map, ignoring expiry
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]models.GeoInfo
+	err     error
+}
+
+func (s *memoryStore) Get(ctx context.Context, prefix string) (models.GeoInfo, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.entries[prefix]
+	return info, ok, s.err
+}
+
+func (s *memoryStore) Put(ctx context.Context, prefix string, info models.GeoInfo, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[prefix] = info
+	return s.err
+}
+
+func (s *memoryStore) DeleteExpired(ctx context.Context) error {
+	return s.err
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	located := models.GeoInfo{IP: "8.8.8.8", CountryCode: "US"}
+
+	t.Run("addresses of a prefix share an entry", func(t *testing.T) {
+		next := &fakeProvider{name: "first", info: located}
+		cache := geo.NewCache(next, testCacheConfig, nil)
+
+		info, err := cache.Lookup(ctx, googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "8.8.8.8", info.IP)
+
+		info, err = cache.Lookup(ctx, netip.MustParseAddr("::ffff:8.8.8.4"))
+		require.NoError(t, err)
+		assert.Equal(t, "8.8.8.4", info.IP)
+		assert.Equal(t, "US", info.CountryCode)
+		assert.Equal(t, "first", info.Provider)
+		assert.Equal(t, 1, next.lookups)
+
+		_, err = cache.Lookup(ctx, netip.MustParseAddr("8.8.4.4"))
+		require.NoError(t, err)
+		assert.Equal(t, 2, next.lookups)
+	})
+
+	t.Run("expired entries are looked up again", func(t *testing.T) {
+		next := &fakeProvider{name: "first", info: located}
+		cfg := testCacheConfig
+		cfg.TTL = time.Millisecond
+		cache := geo.NewCache(next, cfg, nil)
+
+		_, err := cache.Lookup(ctx, googleDNS)
+		require.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+		_, err = cache.Lookup(ctx, googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, 2, next.lookups)
+
+		require.NoError(t, cache.Cleanup(ctx))
+		time.Sleep(5 * time.Millisecond)
+		require.NoError(t, cache.Cleanup(ctx))
+		assert.Equal(t, 0, cache.Len())
+	})
+
+	t.Run("not found is cached, failures are not", func(t *testing.T) {
+		next := &fakeProvider{name: "first", err: geo.ErrNotFound}
+		cache := geo.NewCache(next, testCacheConfig, nil)
+
+		for range 2 {
+			_, err := cache.Lookup(ctx, netip.MustParseAddr("10.0.0.1"))
+			assert.ErrorIs(t, err, geo.ErrNotFound)
+		}
+		assert.Equal(t, 1, next.lookups)
+
+		next.err = errors.New("timeout")
+		for range 2 {
+			_, err := cache.Lookup(ctx, googleDNS)
+			assert.Error(t, err)
+		}
+		assert.Equal(t, 3, next.lookups)
+	})
+
+	t.Run("least recently used entries are evicted", func(t *testing.T) {
+		next := &fakeProvider{name: "first", info: located}
+		cfg := testCacheConfig
+		cfg.MaxEntries = 2
+		cache := geo.NewCache(next, cfg, nil)
+
+		for _, ip := range []string{"1.1.1.1", "2.2.2.2", "1.1.1.1", "3.3.3.3"} {
+			_, err := cache.Lookup(ctx, netip.MustParseAddr(ip))
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 3, next.lookups)
+		assert.Equal(t, 2, cache.Len())
+
+		// 2.2.2.2 was evicted, 1.1.1.1 was kept
+		_, err := cache.Lookup(ctx, netip.MustParseAddr("1.1.1.1"))
+		require.NoError(t, err)
+		assert.Equal(t, 3, next.lookups)
+		_, err = cache.Lookup(ctx, netip.MustParseAddr("2.2.2.2"))
+		require.NoError(t, err)
+		assert.Equal(t, 4, next.lookups)
+	})
+
+	t.Run("concurrent lookups are deduplicated", func(t *testing.T) {
+		next := &blockingProvider{release: make(chan struct{})}
+		cache := geo.NewCache(next, testCacheConfig, nil)
+
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ip := netip.AddrFrom4([4]byte{8, 8, 8, byte(i)})
+				info, err := cache.Lookup(ctx, ip)
+				assert.NoError(t, err)
+				assert.Equal(t, ip.String(), info.IP)
+			}()
+		}
+		// let the lookups pile up behind the first one
+		time.Sleep(20 * time.Millisecond)
+		close(next.release)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), next.lookups.Load())
+	})
+
+	t.Run("a cancelled caller does not fail the shared lookup", func(t *testing.T) {
+		next := &blockingProvider{release: make(chan struct{})}
+		cache := geo.NewCache(next, testCacheConfig, nil)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() {
+			_, err := cache.Lookup(cancelled, googleDNS)
+			done <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+
+		close(next.release)
+		info, err := cache.Lookup(ctx, googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "US", info.CountryCode)
+		assert.Equal(t, int32(1), next.lookups.Load())
+	})
+
+	t.Run("persistent tier is shared", func(t *testing.T) {
+		store := &memoryStore{entries: make(map[string]models.GeoInfo)}
+		next := &fakeProvider{name: "first", info: located}
+
+		_, err := geo.NewCache(next, testCacheConfig, store).Lookup(ctx, googleDNS)
+		require.NoError(t, err)
+		assert.Contains(t, store.entries, "8.8.8.0/24")
+
+		// another instance finds the entry without asking the provider
+		info, err := geo.NewCache(next, testCacheConfig, store).Lookup(ctx, netip.MustParseAddr("8.8.8.4"))
+		require.NoError(t, err)
+		assert.Equal(t, "8.8.8.4", info.IP)
+		assert.Equal(t, 1, next.lookups)
+	})
+
+	t.Run("failing persistent tier is skipped", func(t *testing.T) {
+		store := &memoryStore{entries: make(map[string]models.GeoInfo), err: errors.New("connection refused")}
+		next := &fakeProvider{name: "first", info: located}
+		cache := geo.NewCache(next, testCacheConfig, store)
+
+		info, err := cache.Lookup(ctx, googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "US", info.CountryCode)
+		assert.Error(t, cache.Cleanup(ctx))
+	})
+}
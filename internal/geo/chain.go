@@ -0,0 +1,114 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+// DefaultQuotaCooldown is how long a provider whose quota is used up is skipped when it does not
+// say when the quota resets
+const DefaultQuotaCooldown = time.Minute
+
+// ErrNoProvider is returned by a chain without providers, or whose providers are all out of quota
+var ErrNoProvider = errors.New("no geolocation provider available")
+
+// Chain asks its providers in turn until one locates the address
+type Chain struct {
+	providers []Provider
+
+	mu sync.Mutex
+	// exhausted holds until when the providers that ran out of quota are skipped
+	exhausted map[string]time.Time
+}
+
+// NewChain returns a provider asking providers in order, falling back to the next one when a
+// provider fails or has no data for the address. A provider that runs out of quota is skipped
+// until its quota resets.
+func NewChain(providers ...Provider) *Chain {
+	return &Chain{
+		providers: providers,
+		exhausted: make(map[string]time.Time),
+	}
+}
+
+func (ch *Chain) Name() string {
+	return "chain"
+}
+
+// Lookup returns the answer of the first provider locating ip. When none does, the error is
+// ErrNotFound if every provider had no data for ip, or else the errors of the providers that failed.
+func (ch *Chain) Lookup(ctx context.Context, ip netip.Addr) (models.GeoInfo, error) {
+	var errs []error
+	for _, provider := range ch.providers {
+		if ch.isExhausted(provider.Name()) {
+			continue
+		}
+
+		info, err := provider.Lookup(ctx, ip)
+		if err == nil {
+			return info, nil
+		}
+		if ctx.Err() != nil {
+			return models.GeoInfo{}, ctx.Err()
+		}
+
+		// the quota errors of a nested chain are tracked by that chain
+		var quotaErr *QuotaError
+		if errors.As(err, &quotaErr) && quotaErr.Provider == provider.Name() {
+			ch.markExhausted(provider.Name(), quotaErr.RetryAfter)
+		}
+		if !errors.Is(err, ErrNotFound) {
+			logger.FromContext(ctx).Warn("geolocation provider failed, falling back",
+				"provider", provider.Name(), "error", err)
+		}
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		return models.GeoInfo{}, ErrNoProvider
+	}
+	// a provider that failed might have located ip, so the address is only unknown when all the
+	// providers said so, and otherwise the failures are returned without the not found answers
+	var failures []error
+	for _, err := range errs {
+		if !errors.Is(err, ErrNotFound) {
+			failures = append(failures, err)
+		}
+	}
+	if len(failures) == 0 {
+		return models.GeoInfo{}, ErrNotFound
+	}
+	return models.GeoInfo{}, fmt.Errorf("all geolocation providers failed: %w", errors.Join(failures...))
+}
+
+func (ch *Chain) isExhausted(name string) bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	until, ok := ch.exhausted[name]
+	if !ok {
+		return false
+	}
+	if time.Now().Before(until) {
+		return true
+	}
+	delete(ch.exhausted, name)
+	return false
+}
+
+func (ch *Chain) markExhausted(name string, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = DefaultQuotaCooldown
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.exhausted[name] = time.Now().Add(retryAfter)
+}
@@ -0,0 +1,127 @@
+package geo_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/geo"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider answers every lookup with info or err and counts the lookups
+type fakeProvider struct {
+	name    string
+	info    models.GeoInfo
+	err     error
+	lookups int
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) Lookup(ctx context.Context, ip netip.Addr) (models.GeoInfo, error) {
+	p.lookups++
+	if p.err != nil {
+		return models.GeoInfo{}, p.err
+	}
+	info := p.info
+	info.Provider = p.name
+	return info, nil
+}
+
+func TestChain(t *testing.T) {
+	located := models.GeoInfo{IP: "8.8.8.8", CountryCode: "US"}
+
+	t.Run("first provider answers", func(t *testing.T) {
+		first := &fakeProvider{name: "first", info: located}
+		second := &fakeProvider{name: "second", info: located}
+
+		info, err := geo.NewChain(first, second).Lookup(context.Background(), googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "first", info.Provider)
+		assert.Equal(t, 0, second.lookups)
+	})
+
+	t.Run("falls back on error", func(t *testing.T) {
+		first := &fakeProvider{name: "first", err: errors.New("connection refused")}
+		second := &fakeProvider{name: "second", info: located}
+
+		info, err := geo.NewChain(first, second).Lookup(context.Background(), googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "second", info.Provider)
+	})
+
+	t.Run("falls back when the address is not found", func(t *testing.T) {
+		first := &fakeProvider{name: "first", err: geo.ErrNotFound}
+		second := &fakeProvider{name: "second", info: located}
+
+		info, err := geo.NewChain(first, second).Lookup(context.Background(), googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "second", info.Provider)
+	})
+
+	t.Run("skips a provider out of quota", func(t *testing.T) {
+		first := &fakeProvider{name: "first", err: &geo.QuotaError{Provider: "first"}}
+		second := &fakeProvider{name: "second", info: located}
+		chain := geo.NewChain(first, second)
+
+		for range 3 {
+			info, err := chain.Lookup(context.Background(), googleDNS)
+			require.NoError(t, err)
+			assert.Equal(t, "second", info.Provider)
+		}
+		assert.Equal(t, 1, first.lookups, "the provider is not asked again until its quota resets")
+		assert.Equal(t, 3, second.lookups)
+	})
+
+	t.Run("a nested chain is not skipped for the quota of one of its providers", func(t *testing.T) {
+		first := &fakeProvider{name: "first", err: &geo.QuotaError{Provider: "first"}}
+		second := &fakeProvider{name: "second", err: errors.New("timeout")}
+		chain := geo.NewChain(geo.NewChain(first, second))
+
+		for range 2 {
+			_, err := chain.Lookup(context.Background(), googleDNS)
+			require.Error(t, err)
+		}
+		assert.Equal(t, 1, first.lookups)
+		assert.Equal(t, 2, second.lookups)
+	})
+
+	t.Run("not found by any provider", func(t *testing.T) {
+		first := &fakeProvider{name: "first", err: geo.ErrNotFound}
+		second := &fakeProvider{name: "second", err: geo.ErrNotFound}
+
+		_, err := geo.NewChain(first, second).Lookup(context.Background(), googleDNS)
+		assert.ErrorIs(t, err, geo.ErrNotFound)
+	})
+
+	t.Run("not found by some providers while others fail", func(t *testing.T) {
+		first := &fakeProvider{name: "first", err: geo.ErrNotFound}
+		second := &fakeProvider{name: "second", err: errors.New("timeout")}
+
+		_, err := geo.NewChain(first, second).Lookup(context.Background(), googleDNS)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, geo.ErrNotFound)
+		assert.Contains(t, err.Error(), "timeout")
+	})
+
+	t.Run("all providers fail", func(t *testing.T) {
+		first := &fakeProvider{name: "first", err: errors.New("timeout")}
+		second := &fakeProvider{name: "second", err: &geo.QuotaError{Provider: "second"}}
+
+		_, err := geo.NewChain(first, second).Lookup(context.Background(), googleDNS)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, geo.ErrQuotaExceeded)
+		assert.Contains(t, err.Error(), "timeout")
+	})
+
+	t.Run("no providers", func(t *testing.T) {
+		_, err := geo.NewChain().Lookup(context.Background(), googleDNS)
+		assert.ErrorIs(t, err, geo.ErrNoProvider)
+	})
+}
@@ -0,0 +1,114 @@
+// Package geo locates IP addresses through pluggable geolocation providers
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+// Provider looks up the network and location of IP addresses
+type Provider interface {
+	// Name identifies the provider in GeoInfo.Provider, logs and metrics
+	Name() string
+	Lookup(ctx context.Context, ip netip.Addr) (models.GeoInfo, error)
+}
+
+var (
+	// ErrNotFound is returned when a provider has no data for an address, e.g. a private one
+	ErrNotFound = errors.New("ip address not found")
+	// ErrQuotaExceeded is matched by the QuotaError returned when a provider refuses requests
+	// until its quota resets
+	ErrQuotaExceeded = errors.New("geolocation quota exceeded")
+)
+
+// QuotaError is returned when a provider rejects a lookup because our quota is used up
+type QuotaError struct {
+	Provider string
+	// RetryAfter is how long until the provider accepts requests again, 0 when unknown
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Provider, ErrQuotaExceeded)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// StatusError is returned when a provider responds with an unexpected status
+type StatusError struct {
+	Provider   string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s responded with %d", e.Provider, e.StatusCode)
+}
+
+// checkStatus returns the error matching the status of a provider response, nil for 200
+func checkStatus(provider string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusTooManyRequests:
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return &QuotaError{Provider: provider, RetryAfter: time.Duration(retryAfter) * time.Second}
+	default:
+		return &StatusError{Provider: provider, StatusCode: resp.StatusCode}
+	}
+}
+
+// parseCoordinate parses a latitude or longitude sent as a string, nil when it is empty or invalid
+func parseCoordinate(value string) *float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// NewFromConfig returns a chain of the providers in cfg.GeoProviders. newClient returns the http
+// client a provider sends its requests with, local is the database opened from cfg.GeoIPDBPath,
+// nil when it is not set. The local database is asked first wherever it is listed, as it answers
+// without a round trip, then the apis in order. cache wraps the chain of the apis, e.g. in a Cache,
+// nil to ask them directly.
+func NewFromConfig(cfg config.Config, newClient func(provider string) *http.Client, local *MMDB, cache func(remote Provider) Provider) (*Chain, error) {
+	var providers, remote []Provider
+	for _, name := range cfg.GeoProviders {
+		switch name {
+		case ProviderMMDB:
+			if local == nil {
+				return nil, errors.New("the mmdb geolocation provider needs GEOIP_DB_PATH")
+			}
+			providers = append(providers, local)
+		case ProviderIPGeolocation:
+			if cfg.GeoAPIKey == "" {
+				slog.Warn("GEO_API_KEY is not set, skipping the ipgeolocation provider")
+				continue
+			}
+			remote = append(remote, NewIPGeolocation(IPGeolocationURL, cfg.GeoAPIKey, newClient(name)))
+		case ProviderGeoJS:
+			remote = append(remote, NewGeoJS(GeoJSURL, newClient(name)))
+		default:
+			return nil, fmt.Errorf("unknown geolocation provider %q", name)
+		}
+	}
+	if len(remote) == 0 {
+		return NewChain(providers...), nil
+	}
+	if cache == nil {
+		return NewChain(append(providers, remote...)...), nil
+	}
+	return NewChain(append(providers, cache(NewChain(remote...)))...), nil
+}
@@ -0,0 +1,98 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+const (
+	ProviderGeoJS = config.GeoProviderGeoJS
+	// GeoJSURL is the base url of the geojs.io api
+	GeoJSURL = "https://get.geojs.io"
+)
+
+type geoJS struct {
+	baseURL string
+	client  *http.Client
+}
+
+type geoJSResponse struct {
+	IP               string      `json:"ip"`
+	OrganizationName string      `json:"organization_name"`
+	Organization     string      `json:"organization"`
+	ASN              json.Number `json:"asn"` // sent as a number or a string
+	CountryCode      string      `json:"country_code"`
+	Country          string      `json:"country"`
+	ContinentCode    string      `json:"continent_code"`
+	Region           string      `json:"region"`
+	City             string      `json:"city"`
+	Timezone         string      `json:"timezone"`
+	Latitude         string      `json:"latitude"`
+	Longitude        string      `json:"longitude"`
+}
+
+// NewGeoJS returns a provider using the geojs.io api at baseURL, e.g. GeoJSURL
+func NewGeoJS(baseURL string, client *http.Client) Provider {
+	return &geoJS{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  client,
+	}
+}
+
+func (p *geoJS) Name() string {
+	return ProviderGeoJS
+}
+
+func (p *geoJS) Lookup(ctx context.Context, ip netip.Addr) (models.GeoInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		p.baseURL+"/v1/ip/geo/"+url.PathEscape(ip.String())+".json", nil)
+	if err != nil {
+		return models.GeoInfo{}, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return models.GeoInfo{}, fmt.Errorf("%s: %v", ProviderGeoJS, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(ProviderGeoJS, resp); err != nil {
+		return models.GeoInfo{}, err
+	}
+
+	var info geoJSResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return models.GeoInfo{}, fmt.Errorf("%s: invalid response: %v", ProviderGeoJS, err)
+	}
+	// geojs answers with the address alone when it has no data for it
+	if info.CountryCode == "" && info.Latitude == "" {
+		return models.GeoInfo{}, ErrNotFound
+	}
+
+	asn, _ := strconv.ParseUint(info.ASN.String(), 10, 32)
+
+	return models.GeoInfo{
+		IP:            ip.String(),
+		ISP:           info.OrganizationName,
+		Organization:  info.Organization,
+		ASN:           uint(asn),
+		CountryCode:   info.CountryCode,
+		CountryName:   info.Country,
+		ContinentCode: info.ContinentCode,
+		Region:        info.Region,
+		City:          info.City,
+		Timezone:      info.Timezone,
+		Latitude:      parseCoordinate(info.Latitude),
+		Longitude:     parseCoordinate(info.Longitude),
+		Provider:      ProviderGeoJS,
+	}, nil
+}
@@ -0,0 +1,102 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+const (
+	ProviderIPGeolocation = config.GeoProviderIPGeolocation
+	// IPGeolocationURL is the base url of the ipgeolocation.io api
+	IPGeolocationURL = "https://api.ipgeolocation.io"
+)
+
+// statusBogon is returned by ipgeolocation for private and reserved addresses
+const statusBogon = http.StatusLocked
+
+type ipGeolocation struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+type ipGeolocationResponse struct {
+	IP            string `json:"ip"`
+	ISP           string `json:"isp"`
+	Organization  string `json:"organization"`
+	CountryCode   string `json:"country_code2"`
+	CountryName   string `json:"country_name"`
+	ContinentCode string `json:"continent_code"`
+	ContinentName string `json:"continent_name"`
+	State         string `json:"state_prov"`
+	City          string `json:"city"`
+	Latitude      string `json:"latitude"`
+	Longitude     string `json:"longitude"`
+	TimeZone      struct {
+		Name string `json:"name"`
+	} `json:"time_zone"`
+}
+
+// NewIPGeolocation returns a provider using the ipgeolocation.io api at baseURL, e.g. IPGeolocationURL
+func NewIPGeolocation(baseURL, apiKey string, client *http.Client) Provider {
+	return &ipGeolocation{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  client,
+	}
+}
+
+func (p *ipGeolocation) Name() string {
+	return ProviderIPGeolocation
+}
+
+func (p *ipGeolocation) Lookup(ctx context.Context, ip netip.Addr) (models.GeoInfo, error) {
+	query := url.Values{"apiKey": {p.apiKey}, "ip": {ip.String()}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/ipgeo?"+query.Encode(), nil)
+	if err != nil {
+		return models.GeoInfo{}, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		// the error holds the url, which holds the api key
+		return models.GeoInfo{}, fmt.Errorf("%s: request failed", ProviderIPGeolocation)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == statusBogon {
+		return models.GeoInfo{}, ErrNotFound
+	}
+	if err := checkStatus(ProviderIPGeolocation, resp); err != nil {
+		return models.GeoInfo{}, err
+	}
+
+	var body ipGeolocationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return models.GeoInfo{}, fmt.Errorf("%s: invalid response: %v", ProviderIPGeolocation, err)
+	}
+
+	return models.GeoInfo{
+		IP:            ip.String(),
+		ISP:           body.ISP,
+		Organization:  body.Organization,
+		CountryCode:   body.CountryCode,
+		CountryName:   body.CountryName,
+		ContinentCode: body.ContinentCode,
+		ContinentName: body.ContinentName,
+		Region:        body.State,
+		City:          body.City,
+		Timezone:      body.TimeZone.Name,
+		Latitude:      parseCoordinate(body.Latitude),
+		Longitude:     parseCoordinate(body.Longitude),
+		Provider:      ProviderIPGeolocation,
+	}, nil
+}
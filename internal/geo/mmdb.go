@@ -0,0 +1,221 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+const ProviderMMDB = config.GeoProviderMMDB
+
+// mmdbRecord holds the fields read from MaxMind (GeoIP2/GeoLite2) and DB-IP databases, city
+// databases fill the location and ASN or ISP databases the network
+type mmdbRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Continent struct {
+		Code  string            `maxminddb:"code"`
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"continent"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+		TimeZone  string   `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	ASOrg        string `maxminddb:"autonomous_system_organization"`
+	ISP          string `maxminddb:"isp"`
+	Organization string `maxminddb:"organization"`
+}
+
+// mmdbFile is a database file, reopened when it changes on disk
+type mmdbFile struct {
+	path    string
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// MMDB locates addresses with local MaxMind or DB-IP databases, without any network round trip
+type MMDB struct {
+	reloadInterval time.Duration
+
+	// mu is held for reading during lookups so a reload never closes a database in use
+	mu    sync.RWMutex
+	files []*mmdbFile
+}
+
+// OpenMMDB opens the city database at path and, when asnPath is not empty, the ASN or ISP
+// database at asnPath. Run reloads them when they change.
+func OpenMMDB(path, asnPath string, reloadInterval time.Duration) (*MMDB, error) {
+	m := &MMDB{reloadInterval: reloadInterval}
+	for _, p := range []string{path, asnPath} {
+		if p == "" {
+			continue
+		}
+		file := &mmdbFile{path: p}
+		if err := file.open(); err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.files = append(m.files, file)
+	}
+	if len(m.files) == 0 {
+		return nil, errors.New("no geolocation database path")
+	}
+	return m, nil
+}
+
+func (m *MMDB) Name() string {
+	return ProviderMMDB
+}
+
+func (m *MMDB) Lookup(ctx context.Context, ip netip.Addr) (models.GeoInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var (
+		record mmdbRecord
+		found  bool
+	)
+	for _, file := range m.files {
+		// each database fills its own fields of the record
+		_, ok, err := file.reader.LookupNetwork(net.IP(ip.Unmap().AsSlice()), &record)
+		if err != nil {
+			return models.GeoInfo{}, fmt.Errorf("%s: %v", ProviderMMDB, err)
+		}
+		found = found || ok
+	}
+	if !found {
+		return models.GeoInfo{}, ErrNotFound
+	}
+
+	info := models.GeoInfo{
+		IP:            ip.String(),
+		ISP:           record.ISP,
+		Organization:  record.Organization,
+		ASN:           record.ASN,
+		CountryCode:   record.Country.ISOCode,
+		CountryName:   record.Country.Names["en"],
+		ContinentCode: record.Continent.Code,
+		ContinentName: record.Continent.Names["en"],
+		City:          record.City.Names["en"],
+		Timezone:      record.Location.TimeZone,
+		Latitude:      record.Location.Latitude,
+		Longitude:     record.Location.Longitude,
+		Provider:      ProviderMMDB,
+	}
+	if len(record.Subdivisions) > 0 {
+		info.Region = record.Subdivisions[0].Names["en"]
+	}
+	// ASN databases only name the organization announcing the network
+	if info.ISP == "" {
+		info.ISP = record.ASOrg
+	}
+	if info.Organization == "" {
+		info.Organization = record.ASOrg
+	}
+	return info, nil
+}
+
+// Reload reopens the databases whose file changed since they were opened. A database that
+// cannot be opened, e.g. while it is being replaced, is kept as it is and retried on the next reload.
+func (m *MMDB) Reload() error {
+	var errs []error
+	for i, file := range m.files {
+		stat, err := os.Stat(file.path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if stat.ModTime().Equal(file.modTime) && stat.Size() == file.size {
+			continue
+		}
+
+		next := &mmdbFile{path: file.path}
+		if err := next.open(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		m.mu.Lock()
+		m.files[i] = next
+		m.mu.Unlock()
+		file.reader.Close()
+
+		slog.Info("geolocation database reloaded", "path", file.path,
+			"build_time", time.Unix(int64(next.reader.Metadata.BuildEpoch), 0).UTC())
+	}
+	return errors.Join(errs...)
+}
+
+// Run reloads the databases that changed every reload interval until ctx is done
+func (m *MMDB) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Reload(); err != nil {
+				slog.Error("failed to reload geolocation database", "error", err)
+			}
+		}
+	}
+}
+
+// Close closes the databases, lookups fail afterwards
+func (m *MMDB) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, file := range m.files {
+		errs = append(errs, file.reader.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (f *mmdbFile) open() error {
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	// the database is read in memory rather than mapped, so that overwriting the file in place
+	// cannot corrupt the lookups in flight
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("failed to open geolocation database %s: %v", f.path, err)
+	}
+
+	f.reader = reader
+	f.modTime = stat.ModTime()
+	f.size = stat.Size()
+	return nil
+}
@@ -0,0 +1,166 @@
+package geo_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/geo"
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeMMDB writes a database holding record for network to path
+func writeMMDB(t *testing.T, path, dbType, network string, record mmdbtype.Map) {
+	t.Helper()
+
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: dbType, RecordSize: 24})
+	require.NoError(t, err)
+	_, ipNet, err := net.ParseCIDR(network)
+	require.NoError(t, err)
+	require.NoError(t, tree.Insert(ipNet, record))
+
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = tree.WriteTo(file)
+	require.NoError(t, err)
+}
+
+func cityRecord(city string) mmdbtype.Map {
+	names := func(name string) mmdbtype.Map {
+		return mmdbtype.Map{"en": mmdbtype.String(name)}
+	}
+	return mmdbtype.Map{
+		"city":      mmdbtype.Map{"names": names(city)},
+		"continent": mmdbtype.Map{"code": mmdbtype.String("NA"), "names": names("North America")},
+		"country":   mmdbtype.Map{"iso_code": mmdbtype.String("US"), "names": names("United States")},
+		"location": mmdbtype.Map{
+			"latitude":  mmdbtype.Float64(37.751),
+			"longitude": mmdbtype.Float64(-97.822),
+			"time_zone": mmdbtype.String("America/Chicago"),
+		},
+		"subdivisions": mmdbtype.Slice{mmdbtype.Map{"names": names("California")}},
+	}
+}
+
+func TestMMDB(t *testing.T) {
+	dir := t.TempDir()
+	cityPath := filepath.Join(dir, "city.mmdb")
+	asnPath := filepath.Join(dir, "asn.mmdb")
+	writeMMDB(t, cityPath, "GeoLite2-City", "8.8.8.0/24", cityRecord("Mountain View"))
+	writeMMDB(t, asnPath, "GeoLite2-ASN", "8.8.8.0/24", mmdbtype.Map{
+		"autonomous_system_number":       mmdbtype.Uint32(15169),
+		"autonomous_system_organization": mmdbtype.String("GOOGLE"),
+	})
+
+	provider, err := geo.OpenMMDB(cityPath, asnPath, time.Minute)
+	require.NoError(t, err)
+	defer provider.Close()
+	assert.Equal(t, geo.ProviderMMDB, provider.Name())
+
+	t.Run("located", func(t *testing.T) {
+		info, err := provider.Lookup(context.Background(), googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "8.8.8.8", info.IP)
+		assert.Equal(t, "GOOGLE", info.ISP)
+		assert.Equal(t, "GOOGLE", info.Organization)
+		assert.Equal(t, uint(15169), info.ASN)
+		assert.Equal(t, "US", info.CountryCode)
+		assert.Equal(t, "United States", info.CountryName)
+		assert.Equal(t, "NA", info.ContinentCode)
+		assert.Equal(t, "North America", info.ContinentName)
+		assert.Equal(t, "California", info.Region)
+		assert.Equal(t, "Mountain View", info.City)
+		assert.Equal(t, "America/Chicago", info.Timezone)
+		require.NotNil(t, info.Latitude)
+		require.NotNil(t, info.Longitude)
+		assert.InDelta(t, 37.751, *info.Latitude, 1e-6)
+		assert.InDelta(t, -97.822, *info.Longitude, 1e-6)
+		assert.Equal(t, geo.ProviderMMDB, info.Provider)
+	})
+
+	t.Run("ipv4 mapped address", func(t *testing.T) {
+		info, err := provider.Lookup(context.Background(), netip.MustParseAddr("::ffff:8.8.8.8"))
+		require.NoError(t, err)
+		assert.Equal(t, "US", info.CountryCode)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := provider.Lookup(context.Background(), netip.MustParseAddr("1.1.1.1"))
+		assert.ErrorIs(t, err, geo.ErrNotFound)
+	})
+
+	t.Run("unchanged files are not reloaded", func(t *testing.T) {
+		require.NoError(t, provider.Reload())
+		info, err := provider.Lookup(context.Background(), googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "Mountain View", info.City)
+	})
+
+	t.Run("hot reload", func(t *testing.T) {
+		// replace the file the way updaters do, by renaming a new one over it
+		next := filepath.Join(dir, "city.mmdb.tmp")
+		writeMMDB(t, next, "GeoLite2-City", "8.8.8.0/24", cityRecord("Palo Alto"))
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(next, later, later))
+		require.NoError(t, os.Rename(next, cityPath))
+
+		require.NoError(t, provider.Reload())
+		info, err := provider.Lookup(context.Background(), googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "Palo Alto", info.City)
+		assert.Equal(t, "GOOGLE", info.ISP)
+	})
+
+	t.Run("invalid file keeps the loaded database", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(cityPath, []byte("not a database"), 0o644))
+
+		assert.Error(t, provider.Reload())
+		info, err := provider.Lookup(context.Background(), googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "Palo Alto", info.City)
+	})
+}
+
+func TestOpenMMDB_Missing(t *testing.T) {
+	_, err := geo.OpenMMDB(filepath.Join(t.TempDir(), "missing.mmdb"), "", time.Minute)
+	assert.Error(t, err)
+}
+
+func TestNewFromConfig_LocalFirst(t *testing.T) {
+	cityPath := filepath.Join(t.TempDir(), "city.mmdb")
+	writeMMDB(t, cityPath, "GeoLite2-City", "8.8.8.0/24", cityRecord("Mountain View"))
+	local, err := geo.OpenMMDB(cityPath, "", time.Minute)
+	require.NoError(t, err)
+	defer local.Close()
+
+	cfg := config.Config{GeoProviders: []string{geo.ProviderGeoJS, geo.ProviderMMDB}}
+	newClient := func(string) *http.Client { return http.DefaultClient }
+	// stands in for the cache, so the apis are not asked
+	cache := &fakeProvider{name: "cache", err: geo.ErrNotFound}
+	var cached []geo.Provider
+	chain, err := geo.NewFromConfig(cfg, newClient, local, func(remote geo.Provider) geo.Provider {
+		cached = append(cached, remote)
+		return cache
+	})
+	require.NoError(t, err)
+	require.Len(t, cached, 1, "the apis are cached together")
+
+	info, err := chain.Lookup(context.Background(), googleDNS)
+	require.NoError(t, err)
+	assert.Equal(t, geo.ProviderMMDB, info.Provider)
+	assert.Equal(t, 0, cache.lookups, "the local database is asked first, without the cache")
+
+	_, err = chain.Lookup(context.Background(), netip.MustParseAddr("1.1.1.1"))
+	assert.ErrorIs(t, err, geo.ErrNotFound)
+	assert.Equal(t, 1, cache.lookups)
+}
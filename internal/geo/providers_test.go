@@ -0,0 +1,149 @@
+package geo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/geo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var googleDNS = netip.MustParseAddr("8.8.8.8")
+
+func TestIPGeolocation(t *testing.T) {
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ipgeo", r.URL.Path)
+		assert.Equal(t, "test-key", r.URL.Query().Get("apiKey"))
+		assert.Equal(t, "8.8.8.8", r.URL.Query().Get("ip"))
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "30")
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	provider := geo.NewIPGeolocation(server.URL, "test-key", server.Client())
+	assert.Equal(t, geo.ProviderIPGeolocation, provider.Name())
+
+	t.Run("located", func(t *testing.T) {
+		status = http.StatusOK
+		body = `{"ip":"8.8.8.8","continent_code":"NA","continent_name":"North America","country_code2":"US",
+			"country_name":"United States","state_prov":"California","city":"Mountain View",
+			"latitude":"37.42240","longitude":"-122.08421","isp":"Google LLC","organization":"Google LLC",
+			"time_zone":{"name":"America/Los_Angeles"}}`
+
+		info, err := provider.Lookup(context.Background(), googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "8.8.8.8", info.IP)
+		assert.Equal(t, "Google LLC", info.ISP)
+		assert.Equal(t, "US", info.CountryCode)
+		assert.Equal(t, "United States", info.CountryName)
+		assert.Equal(t, "NA", info.ContinentCode)
+		assert.Equal(t, "California", info.Region)
+		assert.Equal(t, "Mountain View", info.City)
+		assert.Equal(t, "America/Los_Angeles", info.Timezone)
+		require.NotNil(t, info.Latitude)
+		require.NotNil(t, info.Longitude)
+		assert.InDelta(t, 37.4224, *info.Latitude, 1e-6)
+		assert.InDelta(t, -122.08421, *info.Longitude, 1e-6)
+		assert.Equal(t, geo.ProviderIPGeolocation, info.Provider)
+	})
+
+	t.Run("quota exceeded", func(t *testing.T) {
+		status = http.StatusTooManyRequests
+		body = `{"message":"quota exceeded"}`
+
+		_, err := provider.Lookup(context.Background(), googleDNS)
+		assert.ErrorIs(t, err, geo.ErrQuotaExceeded)
+		var quotaErr *geo.QuotaError
+		require.ErrorAs(t, err, &quotaErr)
+		assert.Equal(t, 30*time.Second, quotaErr.RetryAfter)
+	})
+
+	t.Run("private address", func(t *testing.T) {
+		status = http.StatusLocked
+		body = `{"message":"bogon"}`
+
+		_, err := provider.Lookup(context.Background(), googleDNS)
+		assert.ErrorIs(t, err, geo.ErrNotFound)
+	})
+
+	t.Run("upstream error", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		body = ``
+
+		_, err := provider.Lookup(context.Background(), googleDNS)
+		var statusErr *geo.StatusError
+		require.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		unreachable := geo.NewIPGeolocation("http://127.0.0.1:0", "test-key", http.DefaultClient)
+		_, err := unreachable.Lookup(context.Background(), googleDNS)
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "test-key", "the api key is not leaked in errors")
+	})
+}
+
+func TestGeoJS(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/ip/geo/8.8.8.8.json", r.URL.Path)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	provider := geo.NewGeoJS(server.URL, server.Client())
+	assert.Equal(t, geo.ProviderGeoJS, provider.Name())
+
+	t.Run("located", func(t *testing.T) {
+		body = `{"ip":"8.8.8.8","organization_name":"GOOGLE","organization":"AS15169 GOOGLE","asn":15169,
+			"country_code":"US","country":"United States","continent_code":"NA","region":"California",
+			"city":"Mountain View","timezone":"America/Chicago","latitude":"37.751","longitude":"-97.822"}`
+
+		info, err := provider.Lookup(context.Background(), googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, "GOOGLE", info.ISP)
+		assert.Equal(t, "AS15169 GOOGLE", info.Organization)
+		assert.Equal(t, uint(15169), info.ASN)
+		assert.Equal(t, "US", info.CountryCode)
+		assert.Equal(t, "United States", info.CountryName)
+		assert.Equal(t, "California", info.Region)
+		require.NotNil(t, info.Latitude)
+		assert.InDelta(t, 37.751, *info.Latitude, 1e-6)
+		assert.Equal(t, geo.ProviderGeoJS, info.Provider)
+	})
+
+	t.Run("asn sent as a string", func(t *testing.T) {
+		body = `{"ip":"8.8.8.8","asn":"15169","country_code":"US","latitude":"37.751","longitude":"-97.822"}`
+
+		info, err := provider.Lookup(context.Background(), googleDNS)
+		require.NoError(t, err)
+		assert.Equal(t, uint(15169), info.ASN)
+	})
+
+	t.Run("unknown address", func(t *testing.T) {
+		body = `{"ip":"8.8.8.8"}`
+
+		_, err := provider.Lookup(context.Background(), googleDNS)
+		assert.ErrorIs(t, err, geo.ErrNotFound)
+	})
+
+	t.Run("invalid response", func(t *testing.T) {
+		body = `<html>`
+
+		_, err := provider.Lookup(context.Background(), googleDNS)
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, geo.ErrNotFound))
+	})
+}
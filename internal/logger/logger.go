@@ -0,0 +1,51 @@
+// Package logger builds the structured logger of the application and carries request scoped
+// loggers through contexts
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+)
+
+type contextKey struct{}
+
+// New returns a logger writing to stdout at cfg.LogLevel, as JSON or as text depending on cfg.LogFormat
+func New(cfg config.Config) *slog.Logger {
+	return NewWithWriter(os.Stdout, cfg)
+}
+
+// NewWithWriter returns a logger like New writing to w
+func NewWithWriter(w io.Writer, cfg config.Config) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(cfg.LogLevel)}
+	if cfg.LogFormat == config.LogFormatText {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// ParseLevel returns the slog level named level, e.g. "debug" or "WARN", info when it is unknown
+func ParseLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// WithContext returns a copy of ctx carrying l
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger when there is none
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
@@ -0,0 +1,49 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("json at the configured level", func(t *testing.T) {
+		var buf bytes.Buffer
+		l := logger.NewWithWriter(&buf, config.Config{LogLevel: "warn", LogFormat: config.LogFormatJSON})
+
+		l.Info("hidden")
+		assert.Empty(t, buf.String())
+
+		l.Warn("shown", "key", "value")
+		assert.Contains(t, buf.String(), `"msg":"shown"`)
+		assert.Contains(t, buf.String(), `"key":"value"`)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		l := logger.NewWithWriter(&buf, config.Config{LogLevel: "debug", LogFormat: config.LogFormatText})
+
+		l.Debug("shown")
+		assert.Contains(t, buf.String(), "level=DEBUG msg=shown")
+	})
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, logger.ParseLevel("debug"))
+	assert.Equal(t, slog.LevelWarn, logger.ParseLevel("WARN"))
+	assert.Equal(t, slog.LevelError, logger.ParseLevel("error"))
+	assert.Equal(t, slog.LevelInfo, logger.ParseLevel("verbose"))
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Same(t, slog.Default(), logger.FromContext(context.Background()))
+
+	l := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	ctx := logger.WithContext(context.Background(), l)
+	assert.Same(t, l, logger.FromContext(ctx))
+}
@@ -0,0 +1,164 @@
+// Package metrics holds the Prometheus collectors of the API and the helpers that feed them
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "speedcheck"
+
+// unmatchedRoute labels requests that did not match any route, so unknown paths cannot grow
+// the number of series
+const unmatchedRoute = "unmatched"
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database queries, by operation and table.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "table"})
+
+	rateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Number of requests rejected by a rate limiter, by limiter.",
+	}, []string{"limiter"})
+
+	upstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Time taken by requests to upstream apis, by upstream and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"upstream", "status"})
+
+	resultsSubmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "speed_test_results_submitted_total",
+		Help:      "Number of speed test results stored, by country code.",
+	}, []string{"country_code"})
+
+	geoCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "geo_cache_lookups_total",
+		Help:      "Number of geolocation cache lookups, by tier and result.",
+	}, []string{"tier", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, dbQueryDuration, rateLimitRejections,
+		upstreamDuration, resultsSubmitted, geoCacheLookups)
+}
+
+// Handler returns the handler serving the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records the count and duration of the requests by route template, e.g. /devices/:id
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		requestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RateLimitRejected counts a request rejected by the named rate limiter
+func RateLimitRejected(limiter string) {
+	if limiter == "" {
+		limiter = "default"
+	}
+	rateLimitRejections.WithLabelValues(limiter).Inc()
+}
+
+// ResultsSubmitted counts n speed test results stored for countryCode
+func ResultsSubmitted(countryCode string, n int) {
+	countryCode = strings.ToUpper(strings.TrimSpace(countryCode))
+	if countryCode == "" {
+		countryCode = "unknown"
+	}
+	resultsSubmitted.WithLabelValues(countryCode).Add(float64(n))
+}
+
+// GeoCacheLookup counts a lookup in the tier of the geolocation cache, e.g. "memory", as a hit or a miss
+func GeoCacheLookup(tier string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	geoCacheLookups.WithLabelValues(tier, result).Inc()
+}
+
+// RegisterLimiter exposes the size of the store of the named rate limiter: the clients it tracks,
+// the clients evicted when it was full and the last request of its least recently seen client.
+// stats is read on every scrape.
+func RegisterLimiter(limiter string, stats func() (entries int, evictions uint64, oldestLastSeen time.Time)) error {
+	labels := prometheus.Labels{"limiter": limiter}
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "rate_limiter_entries",
+			Help:        "Number of clients tracked by a rate limiter, by limiter.",
+			ConstLabels: labels,
+		}, func() float64 {
+			entries, _, _ := stats()
+			return float64(entries)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "rate_limiter_evictions_total",
+			Help:        "Number of clients evicted from a full rate limiter, by limiter.",
+			ConstLabels: labels,
+		}, func() float64 {
+			_, evictions, _ := stats()
+			return float64(evictions)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "rate_limiter_oldest_last_seen_timestamp_seconds",
+			Help:        "Time of the last request of the least recently seen client of a rate limiter, 0 when it tracks none, by limiter.",
+			ConstLabels: labels,
+		}, func() float64 {
+			_, _, oldestLastSeen := stats()
+			if oldestLastSeen.IsZero() {
+				return 0
+			}
+			return float64(oldestLastSeen.UnixNano()) / float64(time.Second)
+		}),
+	}
+	for _, collector := range collectors {
+		if err := prometheus.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
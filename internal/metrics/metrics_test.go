@@ -0,0 +1,92 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/checkspeed/sc-backend/internal/metrics"
+)
+
+// scrape returns the metrics exposed by metrics.Handler
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(metrics.Middleware())
+	router.GET("/devices/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, path := range []string{"/devices/1", "/devices/2", "/unknown/path"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	body := scrape(t)
+	assert.Contains(t, body, `speedcheck_http_requests_total{method="GET",route="/devices/:id",status="204"} 2`)
+	assert.Contains(t, body, `speedcheck_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `speedcheck_http_request_duration_seconds_count{method="GET",route="/devices/:id",status="204"} 2`)
+	assert.NotContains(t, body, "/devices/1")
+}
+
+func TestTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer upstream.Close()
+
+	resp, err := metrics.Client("test_upstream").Get(upstream.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	_, err = metrics.Client("test_upstream").Get("http://127.0.0.1:0")
+	require.Error(t, err)
+
+	body := scrape(t)
+	assert.Contains(t, body, `speedcheck_upstream_request_duration_seconds_count{status="418",upstream="test_upstream"} 1`)
+	assert.Contains(t, body, `speedcheck_upstream_request_duration_seconds_count{status="error",upstream="test_upstream"} 1`)
+}
+
+func TestCounters(t *testing.T) {
+	metrics.ResultsSubmitted("ng", 2)
+	metrics.ResultsSubmitted("NG", 1)
+	metrics.ResultsSubmitted("", 1)
+	metrics.RateLimitRejected("submit")
+	metrics.GeoCacheLookup("memory", true)
+	metrics.GeoCacheLookup("memory", false)
+	metrics.GeoCacheLookup("memory", true)
+
+	body := scrape(t)
+	assert.Contains(t, body, `speedcheck_speed_test_results_submitted_total{country_code="NG"} 3`)
+	assert.Contains(t, body, `speedcheck_speed_test_results_submitted_total{country_code="unknown"} 1`)
+	assert.Contains(t, body, `speedcheck_rate_limit_rejections_total{limiter="submit"} 1`)
+	assert.Contains(t, body, `speedcheck_geo_cache_lookups_total{result="hit",tier="memory"} 2`)
+	assert.Contains(t, body, `speedcheck_geo_cache_lookups_total{result="miss",tier="memory"} 1`)
+}
+
+func TestRegisterLimiter(t *testing.T) {
+	oldest := time.Unix(1700000000, 0)
+	err := metrics.RegisterLimiter("test_limiter", func() (int, uint64, time.Time) {
+		return 3, 2, oldest
+	})
+	require.NoError(t, err)
+
+	body := scrape(t)
+	assert.Contains(t, body, `speedcheck_rate_limiter_entries{limiter="test_limiter"} 3`)
+	assert.Contains(t, body, `speedcheck_rate_limiter_evictions_total{limiter="test_limiter"} 2`)
+	assert.Contains(t, body, `speedcheck_rate_limiter_oldest_last_seen_timestamp_seconds{limiter="test_limiter"} 1.7e+09`)
+
+	err = metrics.RegisterLimiter("test_limiter", func() (int, uint64, time.Time) {
+		return 0, 0, time.Time{}
+	})
+	assert.Error(t, err, "a limiter is only registered once")
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Upstream names used to label upstream requests
+const (
+	UpstreamIPGeolocation = "ipgeolocation"
+	UpstreamGeoJS         = "geojs"
+	UpstreamNotion        = "notion"
+)
+
+// transport records the duration of the requests sent through next
+type transport struct {
+	upstream string
+	next     http.RoundTripper
+}
+
+// Transport wraps next, or http.DefaultTransport when nil, to record the latency of the requests
+// to upstream. Requests that fail before a response is received have the status "error".
+func Transport(upstream string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{upstream: upstream, next: next}
+}
+
+// Client returns an http client whose requests are recorded as requests to upstream
+func Client(upstream string) *http.Client {
+	return &http.Client{Transport: Transport(upstream, nil)}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	upstreamDuration.WithLabelValues(t.upstream, status).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
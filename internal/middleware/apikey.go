@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/auth"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// APIKeyHeader is the header partners send their API key in
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyKey is the gin context key holding the authenticated *models.APIKey
+const apiKeyKey = "auth.api_key"
+
+// APIKeyStore looks up API keys by the hash of the key
+type APIKeyStore interface {
+	GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+}
+
+// KeyLimiter holds the daily quota of each API key as a token bucket, like ClientLimiter does
+// for IP addresses. The bucket holds a full day of requests and refills continuously.
+type KeyLimiter struct {
+	store LimiterStore
+}
+
+// NewKeyLimiter creates a new API key limiter keeping the quotas in store
+func NewKeyLimiter(store LimiterStore) *KeyLimiter {
+	return &KeyLimiter{store: store}
+}
+
+// Run cleans up the quotas that refilled completely every cleanup interval until ctx is done
+func (kl *KeyLimiter) Run(ctx context.Context) {
+	RunCleanup(ctx, "api key limiter", kl.store, DefaultCleanupInterval)
+}
+
+// RegisterMetrics exposes the size of the store of the quotas in the metrics as the "apikey" limiter,
+// it is skipped when the store does not report its size
+func (kl *KeyLimiter) RegisterMetrics() error {
+	return registerStoreMetrics("apikey", kl.store)
+}
+
+// Take takes a request from the daily quota of apiKey
+func (kl *KeyLimiter) Take(ctx context.Context, apiKey *models.APIKey) (LimitResult, error) {
+	limit := rate.Every(24 * time.Hour / time.Duration(max(apiKey.DailyQuota, 1)))
+	return kl.store.Take(ctx, "apikey:"+apiKey.ID, limit, apiKey.DailyQuota)
+}
+
+// APIKeyAuth middleware authenticates partners by the X-API-Key header and enforces the daily
+// quota of their key
+func APIKeyAuth(keys APIKeyStore, quotas *KeyLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "API key required",
+				Code:    "API_KEY_REQUIRED",
+			})
+			return
+		}
+
+		apiKey, err := keys.GetByHash(c.Request.Context(), auth.HashAPIKey(key))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, models.ApiResp{
+					Status:  models.StatusFail,
+					Message: "Invalid API key",
+					Code:    "INVALID_API_KEY",
+				})
+				return
+			}
+
+			logger.FromContext(c.Request.Context()).Error("api key query failed", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError,
+				Message: "Internal server error", Code: "INTERNAL_ERROR"})
+			return
+		}
+
+		// partners are billed by their quota, so unlike the client limits a failing store does not
+		// let their requests through
+		result, err := quotas.Take(c.Request.Context(), apiKey)
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Error("limiter store failed, rejecting request", "error", err)
+			c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(time.Minute)))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, models.ApiResp{
+				Status:  models.StatusError,
+				Message: "Quota service unavailable",
+				Code:    "SERVICE_UNAVAILABLE",
+			})
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(apiKey.DailyQuota))
+		if !result.Allowed {
+			c.Header("X-RateLimit-Remaining", "0")
+			c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(result.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, models.ApiResp{
+				Status:  models.StatusError,
+				Message: "Daily quota of this API key exceeded",
+				Code:    "QUOTA_EXCEEDED",
+			})
+			return
+		}
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
+		c.Set(apiKeyKey, apiKey)
+		c.Next()
+	}
+}
+
+// APIKey returns the API key authenticated by APIKeyAuth
+func APIKey(c *gin.Context) (*models.APIKey, bool) {
+	apiKey, ok := c.Get(apiKeyKey)
+	if !ok {
+		return nil, false
+	}
+	k, ok := apiKey.(*models.APIKey)
+	return k, ok
+}
@@ -0,0 +1,78 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/auth"
+	"github.com/checkspeed/sc-backend/internal/middleware"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type fakeAPIKeys map[string]*models.APIKey
+
+func (f fakeAPIKeys) GetByHash(_ context.Context, keyHash string) (*models.APIKey, error) {
+	if apiKey, ok := f[keyHash]; ok {
+		return apiKey, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	apiKey, err := auth.NewAPIKey("Acme ISP", 2)
+	require.NoError(t, err)
+	keys := fakeAPIKeys{apiKey.KeyHash: &apiKey.APIKey}
+
+	router := gin.New()
+	router.Use(middleware.APIKeyAuth(keys, middleware.NewKeyLimiter(middleware.NewMemoryLimiterStore(0))))
+	router.GET("/test", func(c *gin.Context) {
+		k, _ := middleware.APIKey(c)
+		c.JSON(http.StatusOK, gin.H{"name": k.Name})
+	})
+
+	request := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		if key != "" {
+			req.Header.Set(middleware.APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("missing key", func(t *testing.T) {
+		w := request("")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "API_KEY_REQUIRED")
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		w := request(apiKey.Key + "0")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_API_KEY")
+	})
+
+	t.Run("requests within the quota succeed", func(t *testing.T) {
+		w := request(apiKey.Key)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Acme ISP")
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+
+		w = request(apiKey.Key)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("requests over the quota are rejected", func(t *testing.T) {
+		w := request(apiKey.Key)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "QUOTA_EXCEEDED")
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/checkspeed/sc-backend/internal/auth"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// gin context keys holding the id and role of the authenticated user
+const (
+	userIDKey = "auth.user_id"
+	roleKey   = "auth.role"
+)
+
+// UserStore looks up users by id, see db.Users
+type UserStore interface {
+	GetByID(ctx context.Context, id string) (*models.User, error)
+}
+
+// RequireAuth middleware rejects requests without a valid bearer token
+func RequireAuth(tokens *auth.TokenManager) gin.HandlerFunc {
+	return authenticate(tokens, true)
+}
+
+// OptionalAuth middleware authenticates requests that carry a bearer token and lets anonymous
+// requests through. A token that is present but invalid is still rejected.
+func OptionalAuth(tokens *auth.TokenManager) gin.HandlerFunc {
+	return authenticate(tokens, false)
+}
+
+// UserID returns the id of the user authenticated by RequireAuth or OptionalAuth
+func UserID(c *gin.Context) (string, bool) {
+	userID := c.GetString(userIDKey)
+	return userID, userID != ""
+}
+
+// Role returns the role of the user authenticated by RequireAuth or OptionalAuth
+func Role(c *gin.Context) string {
+	return c.GetString(roleKey)
+}
+
+// RequireRole middleware only lets users with one of roles through, it must run after RequireAuth.
+// The role is the one the user has now in users rather than the one in the token, so users that
+// were demoted or deleted lose their access before their token expires.
+func RequireRole(users UserStore, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := UserID(c)
+		if !ok {
+			unauthorized(c, "Authentication required")
+			return
+		}
+
+		user, err := users.GetByID(c.Request.Context(), userID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				unauthorized(c, "User no longer exists")
+				return
+			}
+
+			logger.FromContext(c.Request.Context()).Error("user query failed", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.ApiResp{Status: models.StatusError,
+				Message: "Internal server error", Code: "INTERNAL_ERROR"})
+			return
+		}
+		c.Set(roleKey, user.Role)
+
+		if !slices.Contains(roles, user.Role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "Insufficient permissions",
+				Code:    "FORBIDDEN",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSameUser middleware only lets the user whose id is in the param path parameter through,
+// it must run after RequireAuth
+func RequireSameUser(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := UserID(c)
+		if !ok {
+			unauthorized(c, "Authentication required")
+			return
+		}
+		if userID != c.Param(param) {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ApiResp{
+				Status:  models.StatusFail,
+				Message: "Access to this user is not allowed",
+				Code:    "FORBIDDEN",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func authenticate(tokens *auth.TokenManager, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			if required {
+				unauthorized(c, "Authentication required")
+				return
+			}
+			c.Next()
+			return
+		}
+
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			unauthorized(c, "Authorization header must be a bearer token")
+			return
+		}
+
+		claims, err := tokens.Parse(strings.TrimSpace(token))
+		if err != nil {
+			unauthorized(c, "Invalid or expired token")
+			return
+		}
+
+		c.Set(userIDKey, claims.Subject)
+		c.Set(roleKey, claims.Role)
+		// the rest of the log lines of the request name the user
+		ctx := c.Request.Context()
+		c.Request = c.Request.WithContext(logger.WithContext(ctx, logger.FromContext(ctx).With("user_id", claims.Subject)))
+		c.Next()
+	}
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="sc-backend"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, models.ApiResp{
+		Status:  models.StatusFail,
+		Message: message,
+		Code:    "UNAUTHORIZED",
+	})
+}
@@ -0,0 +1,94 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/auth"
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/middleware"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeUsers holds the current role of each user by id
+type fakeUsers map[string]string
+
+func (f fakeUsers) GetByID(_ context.Context, id string) (*models.User, error) {
+	role, ok := f[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &models.User{ID: id, Role: role}, nil
+}
+
+func TestAuth(t *testing.T) {
+	tokens, err := auth.NewTokenManager(config.Config{JWTSecret: "secret", JWTTTL: time.Hour})
+	require.NoError(t, err)
+	token, _, err := tokens.Issue("user-1", models.RoleUser)
+	require.NoError(t, err)
+
+	whoami := func(c *gin.Context) {
+		userID, _ := middleware.UserID(c)
+		c.JSON(http.StatusOK, gin.H{"user_id": userID})
+	}
+
+	router := gin.New()
+	router.GET("/required", middleware.RequireAuth(tokens), whoami)
+	router.GET("/optional", middleware.OptionalAuth(tokens), whoami)
+	router.GET("/users/:id", middleware.RequireAuth(tokens), middleware.RequireSameUser("id"), whoami)
+	users := fakeUsers{"user-1": models.RoleUser, "admin-1": models.RoleAdmin, "demoted-1": models.RoleUser}
+	router.GET("/admin", middleware.RequireAuth(tokens), middleware.RequireRole(users, models.RoleAdmin), whoami)
+
+	adminToken, _, err := tokens.Issue("admin-1", models.RoleAdmin)
+	require.NoError(t, err)
+	// tokens issued while the users were admins
+	demotedToken, _, err := tokens.Issue("demoted-1", models.RoleAdmin)
+	require.NoError(t, err)
+	deletedToken, _, err := tokens.Issue("deleted-1", models.RoleAdmin)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		path          string
+		authorization string
+		wantCode      int
+		wantBody      string
+	}{
+		{"required without token", "/required", "", http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"required with token", "/required", "Bearer " + token, http.StatusOK, "user-1"},
+		{"required with invalid token", "/required", "Bearer " + token + "x", http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"required with other scheme", "/required", "Basic " + token, http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"optional without token", "/optional", "", http.StatusOK, `"user_id":""`},
+		{"optional with token", "/optional", "Bearer " + token, http.StatusOK, "user-1"},
+		{"optional with invalid token", "/optional", "Bearer invalid", http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"same user", "/users/user-1", "Bearer " + token, http.StatusOK, "user-1"},
+		{"other user", "/users/user-2", "Bearer " + token, http.StatusForbidden, "FORBIDDEN"},
+		{"admin without token", "/admin", "", http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"admin with user role", "/admin", "Bearer " + token, http.StatusForbidden, "FORBIDDEN"},
+		{"admin with admin role", "/admin", "Bearer " + adminToken, http.StatusOK, "admin-1"},
+		{"admin demoted since the token", "/admin", "Bearer " + demotedToken, http.StatusForbidden, "FORBIDDEN"},
+		{"admin deleted since the token", "/admin", "Bearer " + deletedToken, http.StatusUnauthorized, "UNAUTHORIZED"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.wantBody)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// LimitResult is the outcome of taking a token from a bucket
+type LimitResult struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// RetryAfter is how long until the next token, set when the request is not allowed
+	RetryAfter time.Duration
+}
+
+// LimiterStore keeps the token buckets of rate limited clients. Limiters sharing a store
+// namespace their keys, so a single store can back all of them.
+type LimiterStore interface {
+	// Take takes a token from the bucket of key, which refills at limit tokens per second up to burst
+	Take(ctx context.Context, key string, limit rate.Limit, burst int) (LimitResult, error)
+	// Cleanup drops the buckets that are full again, they are recreated on the next request
+	Cleanup(ctx context.Context) error
+}
+
+// cleanupBatchSize is the number of entries a memory store cleanup checks per lock acquisition
+const cleanupBatchSize = 1000
+
+// memoryLimiterStore keeps the buckets in process, limits are per instance. Entries are kept
+// in least recently used order, so the oldest can be evicted when maxEntries is reached.
+type memoryLimiterStore struct {
+	entries    map[string]*list.Element
+	lru        *list.List // front is the most recently used
+	maxEntries int
+	evictions  uint64
+	mutex      sync.Mutex
+}
+
+type memoryEntry struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewMemoryLimiterStore creates a LimiterStore keeping buckets in memory, it is the default.
+// It holds at most maxEntries buckets, evicting the least recently used, 0 means no limit.
+func NewMemoryLimiterStore(maxEntries int) LimiterStore {
+	return &memoryLimiterStore{
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+func (m *memoryLimiterStore) Take(_ context.Context, key string, limit rate.Limit, burst int) (LimitResult, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	var entry *memoryEntry
+	if elem, exists := m.entries[key]; exists {
+		entry = elem.Value.(*memoryEntry)
+		m.lru.MoveToFront(elem)
+		if entry.limiter.Limit() != limit || entry.limiter.Burst() != burst {
+			entry.limiter.SetLimitAt(now, limit)
+			entry.limiter.SetBurstAt(now, burst)
+		}
+	} else {
+		if m.maxEntries > 0 && m.lru.Len() >= m.maxEntries {
+			// evicting a client resets its allowance, which is preferable to growing without bound
+			oldest := m.lru.Back()
+			m.lru.Remove(oldest)
+			delete(m.entries, oldest.Value.(*memoryEntry).key)
+			m.evictions++
+		}
+		entry = &memoryEntry{key: key, limiter: rate.NewLimiter(limit, burst)}
+		m.entries[key] = m.lru.PushFront(entry)
+	}
+	entry.lastSeen = now
+
+	reservation := entry.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); !reservation.OK() || delay > 0 {
+		reservation.CancelAt(now)
+		return LimitResult{RetryAfter: delay}, nil
+	}
+	return LimitResult{Allowed: true, Remaining: max(int(entry.limiter.TokensAt(now)), 0)}, nil
+}
+
+// Cleanup removes the buckets that are full again. It walks the entries from the least
+// recently used in batches, releasing the lock between them so requests are not held up.
+func (m *memoryLimiterStore) Cleanup(ctx context.Context) error {
+	m.mutex.Lock()
+	elem := m.lru.Back()
+	m.mutex.Unlock()
+
+	for elem != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		m.mutex.Lock()
+		now := time.Now()
+		for i := 0; i < cleanupBatchSize && elem != nil; i++ {
+			prev := elem.Prev()
+			entry := elem.Value.(*memoryEntry)
+			// entries removed or moved to the front since the last batch end the walk
+			if current, ok := m.entries[entry.key]; !ok || current != elem {
+				prev = nil
+			} else if entry.limiter.TokensAt(now) >= float64(entry.limiter.Burst()) {
+				// If limiter has full tokens available, it hasn't been used recently
+				m.lru.Remove(elem)
+				delete(m.entries, entry.key)
+			}
+			elem = prev
+		}
+		m.mutex.Unlock()
+	}
+	return nil
+}
+
+// Stats returns the number of buckets held and evicted so far
+func (m *memoryLimiterStore) Stats() LimiterStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := LimiterStats{Entries: m.lru.Len(), Evictions: m.evictions}
+	if elem := m.lru.Back(); elem != nil {
+		stats.OldestLastSeen = elem.Value.(*memoryEntry).lastSeen
+	}
+	return stats
+}
+
+// LimiterStats describes the buckets held by a LimiterStore
+type LimiterStats struct {
+	Entries   int
+	Evictions uint64
+	// OldestLastSeen is the last time the least recently used client made a request
+	OldestLastSeen time.Time
+}
+
+// statsStore is implemented by the LimiterStores that can report their size cheaply
+type statsStore interface {
+	Stats() LimiterStats
+}
+
+// TokenBuckets are token buckets kept in a database shared by all instances, see db.RateLimitBuckets
+type TokenBuckets interface {
+	// Take takes a token from the bucket of key refilling at refillRate tokens per second up to
+	// burst, and returns whether it was allowed and the tokens left
+	Take(ctx context.Context, key string, refillRate float64, burst int) (bool, float64, error)
+	// DeleteFull deletes the buckets that have refilled completely
+	DeleteFull(ctx context.Context) error
+}
+
+type sharedLimiterStore struct {
+	buckets TokenBuckets
+}
+
+// NewSharedLimiterStore creates a LimiterStore backed by buckets, so limits hold across instances
+func NewSharedLimiterStore(buckets TokenBuckets) LimiterStore {
+	return &sharedLimiterStore{buckets: buckets}
+}
+
+func (s *sharedLimiterStore) Take(ctx context.Context, key string, limit rate.Limit, burst int) (LimitResult, error) {
+	if limit == rate.Inf {
+		return LimitResult{Allowed: true, Remaining: burst}, nil
+	}
+
+	allowed, tokens, err := s.buckets.Take(ctx, key, float64(limit), burst)
+	if err != nil {
+		return LimitResult{}, err
+	}
+	if !allowed {
+		var retryAfter time.Duration
+		if limit > 0 {
+			retryAfter = time.Duration((1 - tokens) / float64(limit) * float64(time.Second))
+		}
+		return LimitResult{RetryAfter: retryAfter}, nil
+	}
+	return LimitResult{Allowed: true, Remaining: int(math.Floor(tokens))}, nil
+}
+
+func (s *sharedLimiterStore) Cleanup(ctx context.Context) error {
+	return s.buckets.DeleteFull(ctx)
+}
@@ -0,0 +1,224 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/auth"
+	"github.com/checkspeed/sc-backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+// fakeBuckets is an in-process stand-in for the database token buckets
+type fakeBuckets struct {
+	mutex   sync.Mutex
+	now     time.Time
+	tokens  map[string]float64
+	updated map[string]time.Time
+	err     error
+}
+
+func newFakeBuckets() *fakeBuckets {
+	return &fakeBuckets{
+		now:     time.Now(),
+		tokens:  make(map[string]float64),
+		updated: make(map[string]time.Time),
+	}
+}
+
+func (f *fakeBuckets) Take(_ context.Context, key string, refillRate float64, burst int) (bool, float64, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.err != nil {
+		return false, 0, f.err
+	}
+
+	tokens, ok := f.tokens[key]
+	if !ok {
+		tokens = float64(burst)
+	} else {
+		tokens = math.Min(float64(burst), tokens+f.now.Sub(f.updated[key]).Seconds()*refillRate)
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	f.tokens[key] = tokens
+	f.updated[key] = f.now
+	return allowed, tokens, nil
+}
+
+func (f *fakeBuckets) DeleteFull(_ context.Context) error {
+	return nil
+}
+
+func TestSharedLimiterStore(t *testing.T) {
+	buckets := newFakeBuckets()
+	store := middleware.NewSharedLimiterStore(buckets)
+
+	// two instances of the server sharing the same store
+	newRouter := func() *gin.Engine {
+		limiter := middleware.NewClientLimiterWithStore(store, "submit", rate.Every(time.Minute), 2)
+		router := gin.New()
+		router.Use(middleware.RateLimit(limiter))
+		router.GET("/test", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"message": "success"})
+		})
+		return router
+	}
+	instances := []*gin.Engine{newRouter(), newRouter()}
+
+	request := func(router *gin.Engine) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "192.168.1.1:12345"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("limits hold across instances", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(instances[0]).Code)
+		assert.Equal(t, http.StatusOK, request(instances[1]).Code)
+
+		w := request(instances[0])
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "60", w.Header().Get("Retry-After"))
+		assert.Equal(t, http.StatusTooManyRequests, request(instances[1]).Code)
+	})
+
+	t.Run("bucket refills over time", func(t *testing.T) {
+		buckets.now = buckets.now.Add(time.Minute)
+
+		w := request(instances[1])
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	})
+
+	t.Run("requests are allowed when the store fails", func(t *testing.T) {
+		buckets.err = errors.New("connection refused")
+		defer func() { buckets.err = nil }()
+
+		assert.Equal(t, http.StatusOK, request(instances[0]).Code)
+	})
+
+	t.Run("partner requests are rejected when the store fails", func(t *testing.T) {
+		apiKey, err := auth.NewAPIKey("Acme ISP", 2)
+		require.NoError(t, err)
+		keys := fakeAPIKeys{apiKey.KeyHash: &apiKey.APIKey}
+
+		router := gin.New()
+		router.Use(middleware.APIKeyAuth(keys, middleware.NewKeyLimiter(store)))
+		router.GET("/test", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"message": "success"})
+		})
+
+		buckets.err = errors.New("connection refused")
+		defer func() { buckets.err = nil }()
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(middleware.APIKeyHeader, apiKey.Key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Contains(t, w.Body.String(), "SERVICE_UNAVAILABLE")
+	})
+}
+
+func TestMemoryLimiterStore(t *testing.T) {
+	store := middleware.NewMemoryLimiterStore(0)
+	ctx := context.Background()
+
+	result, err := store.Take(ctx, "key", rate.Every(time.Minute), 2)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+
+	result, err = store.Take(ctx, "key", rate.Every(time.Minute), 2)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, err = store.Take(ctx, "key", rate.Every(time.Minute), 2)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.InDelta(t, time.Minute.Seconds(), result.RetryAfter.Seconds(), 1)
+
+	// other keys have their own bucket
+	result, err = store.Take(ctx, "other", rate.Every(time.Minute), 2)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
+
+func TestMemoryLimiterStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	limiter := middleware.NewClientLimiterWithStore(middleware.NewMemoryLimiterStore(2), "submit",
+		rate.Every(time.Minute), 1)
+
+	for _, ip := range []string{"192.168.1.1", "192.168.1.2"} {
+		result, err := limiter.Take(ctx, ip)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+
+	// the third client evicts the least recently used, whose allowance starts over
+	result, err := limiter.Take(ctx, "192.168.1.3")
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	stats, ok := limiter.Stats()
+	require.True(t, ok)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, uint64(1), stats.Evictions)
+
+	result, err = limiter.Take(ctx, "192.168.1.1")
+	require.NoError(t, err)
+	assert.True(t, result.Allowed, "evicted client should get a new allowance")
+
+	result, err = limiter.Take(ctx, "192.168.1.3")
+	require.NoError(t, err)
+	assert.False(t, result.Allowed, "recently used client should still be limited")
+}
+
+func TestClientLimiterCleanup(t *testing.T) {
+	ctx := context.Background()
+	// refills instantly, so every bucket is full again by the time of the cleanup
+	limiter := middleware.NewClientLimiter(rate.Inf/2, 1)
+
+	for _, ip := range []string{"192.168.1.1", "192.168.1.2"} {
+		_, err := limiter.Take(ctx, ip)
+		require.NoError(t, err)
+	}
+
+	err := limiter.CleanupStaleIPs(ctx)
+	require.NoError(t, err)
+
+	stats, ok := limiter.Stats()
+	require.True(t, ok)
+	assert.Equal(t, 0, stats.Entries)
+
+	t.Run("Run stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			limiter.Run(ctx)
+			close(done)
+		}()
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Run did not return after the context was cancelled")
+		}
+	})
+}
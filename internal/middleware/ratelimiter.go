@@ -1,89 +1,192 @@
 package middleware
 
 import (
+	"context"
+	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"net/netip"
+	"strconv"
 	"time"
 
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/metrics"
 	"github.com/checkspeed/sc-backend/internal/models"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 )
 
+const (
+	// DefaultMaxEntries bounds the clients tracked by an in memory limiter, e.g. under an IP spraying attack
+	DefaultMaxEntries = 100000
+	// DefaultCleanupInterval is how often Run removes the limiters of clients that went quiet
+	DefaultCleanupInterval = time.Minute
+)
+
 // ClientLimiter holds rate limiters for each client (IP address)
 type ClientLimiter struct {
-	ips   map[string]*rate.Limiter
-	mutex sync.RWMutex
+	store LimiterStore
+	// name namespaces the keys of the limiter in a shared store
+	name  string
 	limit rate.Limit
 	burst int
+	// allowlist holds the networks of clients that are not rate limited
+	allowlist []netip.Prefix
+
+	cleanupInterval time.Duration
+}
+
+// NewClientLimiter creates a new client limiter allowing limit requests per second in bursts of burst
+// requests, e.g. rate.Every(time.Minute) with burst of 1 for 1 request per minute.
+// Clients in allowlist are not limited. The limits are kept in memory.
+func NewClientLimiter(limit rate.Limit, burst int, allowlist ...netip.Prefix) *ClientLimiter {
+	return NewClientLimiterWithStore(NewMemoryLimiterStore(DefaultMaxEntries), "", limit, burst, allowlist...)
 }
 
-// NewClientLimiter creates a new client limiter
-// For 1 request per minute: rate.Every(time.Minute) with burst of 1
-func NewClientLimiter() *ClientLimiter {
+// NewClientLimiterWithStore creates a client limiter keeping its limits in store under name
+func NewClientLimiterWithStore(store LimiterStore, name string, limit rate.Limit, burst int,
+	allowlist ...netip.Prefix) *ClientLimiter {
 	return &ClientLimiter{
-		ips:   make(map[string]*rate.Limiter),
-		limit: rate.Every(time.Minute), // 1 request per minute
-		burst: 1,
+		store:     store,
+		name:      name,
+		limit:     limit,
+		burst:     burst,
+		allowlist: allowlist,
+
+		cleanupInterval: DefaultCleanupInterval,
 	}
 }
 
-// GetLimiter returns the rate limiter for a specific IP
-func (cl *ClientLimiter) GetLimiter(ip string) *rate.Limiter {
-	cl.mutex.Lock()
-	defer cl.mutex.Unlock()
+// Name returns the name of the limiter, e.g. the route group it limits
+func (cl *ClientLimiter) Name() string {
+	return cl.name
+}
 
-	limiter, exists := cl.ips[ip]
-	if !exists {
-		limiter = rate.NewLimiter(cl.limit, cl.burst)
-		cl.ips[ip] = limiter
+// Allowed reports whether ip is in the allowlist
+func (cl *ClientLimiter) Allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range cl.allowlist {
+		if prefix.Contains(addr) {
+			return true
+		}
 	}
-	return limiter
+	return false
+}
+
+// Take takes a request from the allowance of ip
+func (cl *ClientLimiter) Take(ctx context.Context, ip string) (LimitResult, error) {
+	return cl.store.Take(ctx, cl.name+":"+ip, cl.limit, cl.burst)
+}
 
+// CleanupStaleIPs removes limiters that haven't been used recently
+// Run calls it periodically to prevent memory leaks
+func (cl *ClientLimiter) CleanupStaleIPs(ctx context.Context) error {
+	return cl.store.Cleanup(ctx)
 }
 
-// CleanupOldLimiters removes limiters that haven't been used recently
-// Call this periodically to prevent memory leaks
-func (cl *ClientLimiter) CleanupStaleIPs() {
-	cl.mutex.Lock()
-	defer cl.mutex.Unlock()
+// Run cleans up stale limiters every cleanup interval until ctx is done
+func (cl *ClientLimiter) Run(ctx context.Context) {
+	RunCleanup(ctx, "rate limiter "+cl.name, cl.store, cl.cleanupInterval)
+}
 
-	toDelete := make([]string, 0)
+// Stats returns the number of clients tracked by the limiter. Stores shared by all instances
+// do not report their size, ok is false for them.
+func (cl *ClientLimiter) Stats() (stats LimiterStats, ok bool) {
+	s, ok := cl.store.(statsStore)
+	if !ok {
+		return LimiterStats{}, false
+	}
+	return s.Stats(), true
+}
 
-	for ip, limiter := range cl.ips {
-		// If limiter has full tokens available, it hasn't been used recently
-		// We can safely remove it to free up memory
-		if limiter.Tokens() >= float64(cl.burst) {
-			toDelete = append(toDelete, ip)
-		}
+// RegisterMetrics exposes the size of the store of the limiter in the metrics, limiters whose store
+// does not report its size are skipped
+func (cl *ClientLimiter) RegisterMetrics() error {
+	return registerStoreMetrics(cl.name, cl.store)
+}
+
+func registerStoreMetrics(name string, store LimiterStore) error {
+	s, ok := store.(statsStore)
+	if !ok {
+		return nil
 	}
-	// Delete the unused limiters
-	for _, ip := range toDelete {
-		delete(cl.ips, ip)
+	return metrics.RegisterLimiter(name, func() (int, uint64, time.Time) {
+		stats := s.Stats()
+		return stats.Entries, stats.Evictions, stats.OldestLastSeen
+	})
+}
+
+// RunCleanup cleans up store every interval until ctx is done. A store shared by several limiters
+// is cleaned up by a single RunCleanup instead of the Run of each limiter.
+func RunCleanup(ctx context.Context, name string, store LimiterStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := store.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("rate limiter cleanup failed", "limiter", name, "error", err)
+			}
+		}
 	}
 }
 
-// RateLimit middleware returns a Gin middleware that implements rate limiting
+// RateLimit middleware returns a Gin middleware that implements rate limiting.
+// Responses carry the X-RateLimit-Limit and X-RateLimit-Remaining headers, rejected requests a
+// Retry-After header with the seconds until the next request is allowed.
+// When the limiter store fails the request is let through rather than failing it.
 func RateLimit(clientLimiter *ClientLimiter) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 		// Get client IP address
 		ip := c.ClientIP()
 
-		// Get the rate limiter for this IP
-		limiter := clientLimiter.GetLimiter(ip)
+		if clientLimiter.limit == rate.Inf || clientLimiter.Allowed(ip) {
+			c.Next()
+			return
+		}
 
 		// check if reuqest is allowed
-		if !limiter.Allow() {
+		result, err := clientLimiter.Take(c.Request.Context(), ip)
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Warn("limiter store failed, allowing request", "limiter", clientLimiter.name, "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(clientLimiter.burst))
+		if !result.Allowed {
+			retryAfter := retryAfterSeconds(result.RetryAfter)
+			c.Header("X-RateLimit-Remaining", "0")
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			metrics.RateLimitRejected(clientLimiter.name)
 			c.JSON(http.StatusTooManyRequests, models.ApiResp{
 				Status:  models.StatusError,
-				Message: "Rate limit exceeded. Please wait 1 minute between requests",
+				Message: "Rate limit exceeded. Please retry in " + strconv.Itoa(retryAfter) + " seconds",
 				Code:    "RATE_LIMIT_EXCEEDED",
 			})
 			c.Abort()
 			return
 		}
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
 		// continue to next handler
 		c.Next()
 	}
 }
+
+// retryAfterSeconds rounds d up to whole seconds, a request that can never be allowed is told
+// to retry in a day
+func retryAfterSeconds(d time.Duration) int {
+	if d == rate.InfDuration || d > 24*time.Hour {
+		d = 24 * time.Hour
+	}
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
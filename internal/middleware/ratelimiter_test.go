@@ -3,16 +3,21 @@ package middleware_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/checkspeed/sc-backend/internal/middleware"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
 )
 
 func TestRateLimiter(t *testing.T) {
 	// Create a new client limiter
-	clientLimiter := middleware.NewClientLimiter()
+	clientLimiter := middleware.NewClientLimiter(rate.Every(time.Minute), 1, netip.MustParsePrefix("10.0.0.0/8"))
 
 	// Create a test router with rate limiting
 	router := gin.New()
@@ -30,6 +35,8 @@ func TestRateLimiter(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 		assert.Contains(t, w.Body.String(), "success")
+		assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
 	})
 
 	t.Run("Second immediate request should be rate limited", func(t *testing.T) {
@@ -41,6 +48,7 @@ func TestRateLimiter(t *testing.T) {
 
 		assert.Equal(t, http.StatusTooManyRequests, w.Code)
 		assert.Contains(t, w.Body.String(), "Rate limit exceeded")
+		assert.Equal(t, "60", w.Header().Get("Retry-After"))
 	})
 
 	t.Run("Different IP should not be rate limited", func(t *testing.T) {
@@ -54,4 +62,55 @@ func TestRateLimiter(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "success")
 	})
 
+	t.Run("Forwarded IP of an untrusted peer should be ignored", func(t *testing.T) {
+		router := gin.New()
+		require.NoError(t, router.SetTrustedProxies(nil))
+		router.Use(middleware.RateLimit(clientLimiter))
+		router.GET("/test", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"message": "success"})
+		})
+
+		for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "192.168.1.3:12345"
+			req.Header.Set("X-Forwarded-For", "10.1.2."+strconv.Itoa(i)) // spoofed internal IP
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, want, w.Code)
+		}
+	})
+
+	t.Run("Forwarded IP of a trusted proxy should be used", func(t *testing.T) {
+		router := gin.New()
+		require.NoError(t, router.SetTrustedProxies([]string{"172.16.0.0/12"}))
+		router.Use(middleware.RateLimit(clientLimiter))
+		router.GET("/test", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"message": "success"})
+		})
+
+		for _, forwarded := range []string{"192.168.1.4", "192.168.1.5"} {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "172.16.0.1:12345"
+			req.Header.Set("X-Forwarded-For", forwarded)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+	})
+
+	t.Run("Allowlisted IP should not be rate limited", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "10.1.2.3:12345" // Internal IP
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+	})
 }
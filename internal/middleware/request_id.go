@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/checkspeed/sc-backend/internal/logger"
+)
+
+// RequestIDHeader carries the id correlating the log lines of a request
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request ids accepted from clients
+const maxRequestIDLength = 128
+
+// gin context key holding the id of the request
+const requestIDKey = "request_id"
+
+// RequestLogger middleware gives every request an id, the one sent by the client in X-Request-ID
+// or a new one, returned in the X-Request-ID response header. The request context carries a
+// logger annotated with the id, see logger.FromContext, which also logs the request once handled.
+func RequestLogger(base *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Set(requestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		attrs := []any{"request_id", requestID, "method", c.Request.Method, "path", c.Request.URL.Path}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.HasTraceID() {
+			attrs = append(attrs, "trace_id", span.TraceID().String())
+		}
+		l := base.With(attrs...)
+		c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context(), l))
+
+		c.Next()
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.FromContext(c.Request.Context()).Log(c.Request.Context(), level, "request handled",
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"duration", time.Since(start),
+			"client_ip", c.ClientIP(),
+			"bytes", c.Writer.Size(),
+		)
+	}
+}
+
+// RequestID returns the id given to the request by RequestLogger
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// validRequestID reports whether id can be used as is, ids are printable ascii so they cannot
+// forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
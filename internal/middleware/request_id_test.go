@@ -0,0 +1,85 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	base := logger.NewWithWriter(&logs, config.Config{LogLevel: "info", LogFormat: config.LogFormatJSON})
+
+	router := gin.New()
+	router.Use(middleware.RequestLogger(base))
+	router.GET("/ping", func(c *gin.Context) {
+		logger.FromContext(c.Request.Context()).Info("handling ping")
+		c.JSON(http.StatusOK, gin.H{"request_id": middleware.RequestID(c)})
+	})
+
+	// lines returns the log lines written since the last call
+	lines := func(t *testing.T) []map[string]any {
+		var entries []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			entries = append(entries, entry)
+		}
+		logs.Reset()
+		return entries
+	}
+
+	t.Run("propagates the client request id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set(middleware.RequestIDHeader, "client-id-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "client-id-1", w.Header().Get(middleware.RequestIDHeader))
+		assert.Contains(t, w.Body.String(), "client-id-1")
+
+		entries := lines(t)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "handling ping", entries[0]["msg"])
+		assert.Equal(t, "request handled", entries[1]["msg"])
+		for _, entry := range entries {
+			assert.Equal(t, "client-id-1", entry["request_id"])
+		}
+		assert.EqualValues(t, http.StatusOK, entries[1]["status"])
+		assert.Equal(t, "/ping", entries[1]["route"])
+	})
+
+	testCases := []struct {
+		name      string
+		requestID string
+	}{
+		{name: "missing", requestID: ""},
+		{name: "too long", requestID: strings.Repeat("a", 129)},
+		{name: "forges log lines", requestID: "id\nlevel=ERROR"},
+	}
+	for _, tc := range testCases {
+		t.Run("assigns an id when the client id is "+tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			req.Header.Set(middleware.RequestIDHeader, tc.requestID)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(middleware.RequestIDHeader)
+			assert.NoError(t, uuid.Validate(requestID))
+			for _, entry := range lines(t) {
+				assert.Equal(t, requestID, entry["request_id"])
+			}
+		})
+	}
+}
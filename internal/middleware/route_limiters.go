@@ -0,0 +1,35 @@
+package middleware
+
+import "github.com/checkspeed/sc-backend/internal/config"
+
+// RouteLimiters holds the client limiter of each rate limited route group, so a client
+// spending its submissions allowance can still use the other routes
+type RouteLimiters struct {
+	Submit   *ClientLimiter
+	Auth     *ClientLimiter
+	Feedback *ClientLimiter
+	Network  *ClientLimiter
+}
+
+// NewRouteLimiters creates the client limiters of limits, keeping each in a store returned by newStore
+func NewRouteLimiters(limits config.RateLimits, newStore func() LimiterStore) *RouteLimiters {
+	newLimiter := func(name string, rl config.RateLimit) *ClientLimiter {
+		cl := NewClientLimiterWithStore(newStore(), name, rl.Limit(), rl.Burst, limits.Allowlist...)
+		if limits.CleanupInterval > 0 {
+			cl.cleanupInterval = limits.CleanupInterval
+		}
+		return cl
+	}
+
+	return &RouteLimiters{
+		Submit:   newLimiter("submit", limits.Submit),
+		Auth:     newLimiter("auth", limits.Auth),
+		Feedback: newLimiter("feedback", limits.Feedback),
+		Network:  newLimiter("network", limits.Network),
+	}
+}
+
+// All returns every client limiter
+func (rl *RouteLimiters) All() []*ClientLimiter {
+	return []*ClientLimiter{rl.Submit, rl.Auth, rl.Feedback, rl.Network}
+}
@@ -1,5 +1,7 @@
 package models
 
+import "strconv"
+
 type ApiStatus string
 
 const (
@@ -15,8 +17,39 @@ type ApiResp struct {
 	Code    string    `json:"code,omitempty"`    // Machine-readable code
 	Error   string    `json:"error,omitempty"`   // Human-readable message
 
+	NextCursor string       `json:"next_cursor,omitempty"` // Cursor of the next page for paginated responses
+	Errors     []FieldError `json:"errors,omitempty"`      // Per field validation errors
+}
+
+// FieldError describes why the value of a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`   // json name of the field
+	Code    string `json:"code"`    // Machine-readable code
+	Message string `json:"message"` // Human-readable message
 }
 
+// GeoInfo is the network and location of an IP address, as found by a geolocation provider
+type GeoInfo struct {
+	IP            string   `json:"ip"`
+	ISP           string   `json:"isp,omitempty"`
+	Organization  string   `json:"organization,omitempty"`
+	ASN           uint     `json:"asn,omitempty"`          // autonomous system number
+	CountryCode   string   `json:"country_code,omitempty"` // 2 letter country code
+	CountryName   string   `json:"country_name,omitempty"`
+	ContinentCode string   `json:"continent_code,omitempty"`
+	ContinentName string   `json:"continent_name,omitempty"`
+	Region        string   `json:"region,omitempty"` // state or province
+	City          string   `json:"city,omitempty"`
+	Timezone      string   `json:"timezone,omitempty"`
+	Latitude      *float64 `json:"latitude"`
+	Longitude     *float64 `json:"longitude"`
+	Provider      string   `json:"provider"` // name of the provider that located the address
+}
+
+// NetworkData is the response of /network and /geolocation before the geolocation providers were
+// added, still returned by them until the next release.
+//
+// Deprecated: use GeoInfo, returned by /v2/network.
 type NetworkData struct {
 	Isp           string `json:"isp,omitempty"`
 	Longitude     string `json:"longitude"`
@@ -28,16 +61,23 @@ type NetworkData struct {
 	State         string `json:"state_prov,omitempty"`
 }
 
-type GeoLocationData struct {
-	OrganizationName string `json:"organization_name,omitempty"`
-	Organization     string `json:"organization,omitempty"`
-	Longitude        string `json:"longitude"`
-	Latitude         string `json:"latitude"`
-	CountryCode      string `json:"country_code,omitempty"` // 2 letter country code
-	Country          string `json:"country,omitempty"`
-	ConitnentName    string `json:"continent_name,omitempty"`
-	ContinentCode    string `json:"continent_code,omitempty"`
-	Region           string `json:"region,omitempty"`
-	City             string `json:"city,omitempty"`
-	Timezone         string `json:"timezone,omitempty"`
+// NewNetworkData returns info in the deprecated NetworkData format
+func NewNetworkData(info GeoInfo) NetworkData {
+	formatCoordinate := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+
+	return NetworkData{
+		Isp:           info.ISP,
+		Longitude:     formatCoordinate(info.Longitude),
+		Latitude:      formatCoordinate(info.Latitude),
+		CountryCode:   info.CountryCode,
+		CountryName:   info.CountryName,
+		ConitnentName: info.ContinentName,
+		ContinentCode: info.ContinentCode,
+		State:         info.Region,
+	}
 }
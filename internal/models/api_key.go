@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type CreateAPIKey struct {
+	Name       string `json:"name"`
+	DailyQuota int    `json:"daily_quota"`
+}
+
+// APIKey is a partner API key, only the sha256 hash of the key is stored
+type APIKey struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	KeyPrefix  string         `json:"key_prefix"` // start of the key, to tell keys apart
+	KeyHash    string         `json:"-"`
+	DailyQuota int            `json:"daily_quota"` // requests allowed per day
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"deleted_at"`
+}
+
+// CreatedAPIKey is returned once when a key is created, the key can not be retrieved later
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
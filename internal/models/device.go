@@ -16,6 +16,15 @@ type CreateDevice struct {
 	ScreenResolution string `json:"screen_resolution,omitempty"`
 }
 
+// UpdateDevice holds the device metadata to change, nil fields are left as they are
+type UpdateDevice struct {
+	OS               *string `json:"os"`
+	DeviceType       *string `json:"device_type"`
+	Manufacturer     *string `json:"manufacturer"`
+	Model            *string `json:"model"`
+	ScreenResolution *string `json:"screen_resolution"`
+}
+
 type Device struct {
 	ID string `json:"id"`
 
@@ -29,6 +38,7 @@ type Device struct {
 	ScreenResolution string  `json:"screen_resolution"`
 	DeviceType       string  `json:"device_type"` // Mobile, Desktop
 	IsPlatformDevice bool    `json:"is_platform_device"`
+	SecretHash       *string `json:"-"` // hash of the secret issued when the device was created, nil for older devices
 
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
@@ -1,7 +1,19 @@
 package models
 
+import "time"
+
 type CreateFeedback struct {
 	Subject string `json:"subject,omitempty"`
 	Message string `json:"message"`
 	Email   string `json:"email,omitempty"`
 }
+
+// Feedback is a feedback entry stored in Notion, Message is a preview of the message
+type Feedback struct {
+	ID        string    `json:"id"`
+	Subject   string    `json:"subject"`
+	Message   string    `json:"message"`
+	Email     string    `json:"email"`
+	URL       string    `json:"url"` // Notion page with the full message
+	CreatedAt time.Time `json:"created_at"`
+}
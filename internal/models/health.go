@@ -0,0 +1,21 @@
+package models
+
+const (
+	CheckOK      = "ok"
+	CheckFailing = "failing"
+)
+
+// HealthCheck is the outcome of one of the dependency checks of the readiness probe, only its
+// status is returned as the probe is public
+type HealthCheck struct {
+	Status   string `json:"status"` // "ok" or "failing"
+	Error    string `json:"-"`
+	Duration string `json:"-"`
+}
+
+// Readiness is the detail returned by the readiness probe
+type Readiness struct {
+	Ready    bool                   `json:"ready"`
+	Draining bool                   `json:"draining"` // set once graceful shutdown has started
+	Checks   map[string]HealthCheck `json:"checks"`
+}
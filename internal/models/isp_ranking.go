@@ -0,0 +1,26 @@
+package models
+
+// MedianEstimate is the median of a metric with its approximate 95% confidence interval
+type MedianEstimate struct {
+	Median  float64 `json:"median"`
+	CILower float64 `json:"ci_lower"`
+	CIUpper float64 `json:"ci_upper"`
+}
+
+// ISPStats holds the median metrics of an ISP over a set of speed test results
+type ISPStats struct {
+	ISP           string         `json:"isp"`
+	ISPCode       string         `json:"isp_code"`
+	SampleCount   int64          `json:"sample_count"`
+	DownloadSpeed MedianEstimate `json:"download_speed"` // kbps
+	UploadSpeed   MedianEstimate `json:"upload_speed"`   // kbps
+	Latency       MedianEstimate `json:"latency"`        // ms
+}
+
+// ISPRanking is the position of an ISP on a leaderboard.
+// ISPs with the same median share a rank and are marked as tied.
+type ISPRanking struct {
+	Rank int  `json:"rank"`
+	Tied bool `json:"tied"`
+	ISPStats
+}
@@ -6,6 +6,11 @@ import (
 
 // api
 type CreateSpeedTestResult struct {
+	// ID is an optional client generated uuid of the result, used as its idempotency key. Retried
+	// submissions of the same device with the same id return the stored result instead of creating
+	// a new one. Stored results get an id generated by the server.
+	ID string `json:"id,omitempty"`
+
 	// Download
 	DownloadSpeed    int `json:"download_speed,omitempty"`     // average | kbps
 	MaxDownloadSpeed int `json:"max_download_speed,omitempty"` // kbps
@@ -26,13 +31,16 @@ type CreateSpeedTestResult struct {
 	UploadLatency   int `json:"upload_latency,omitempty"`   // ms
 
 	// Device and Server
-	DeviceID         string `json:"device_id,omitempty"`
-	ISP              string `json:"isp,omitempty"`
-	ISPCode          string `json:"isp_code,omitempty"`
-	ConnectionType   string `json:"connection_type,omitempty"`
-	ConnectionDevice string `json:"connection_device,omitempty"`
-	TestPlatform     string `json:"test_platform,omitempty"`
-	ServerName       string `json:"server_name"`
+	DeviceID             string `json:"device_id,omitempty"`
+	DeviceSecret         string `json:"device_secret,omitempty"` // proves the device is held when it is linked to the user
+	ISP                  string `json:"isp,omitempty"`
+	ISPCode              string `json:"isp_code,omitempty"`
+	ConnectionType       string `json:"connection_type,omitempty"`
+	ConnectionDevice     string `json:"connection_device,omitempty"`
+	TestPlatform         string `json:"test_platform,omitempty"`
+	ServerName           string `json:"server_name"`                      // deprecated, matched against the test server identifiers, not stored
+	TestServerID         string `json:"test_server_id,omitempty"`         // id of a registered test server
+	TestServerIdentifier string `json:"test_server_identifier,omitempty"` // identifier of a registered test server
 
 	// Location
 	State          string  `json:"state,omitempty"`
@@ -44,23 +52,43 @@ type CreateSpeedTestResult struct {
 	Latitude       float64 `json:"latitude,omitempty"`
 	LocationAccess bool    `json:"location_access,omitempty"`
 
-	TestTime string `json:"test_time"`
+	TestTime string `json:"test_time"` // RFC3339 or RFC1123, defaults to the time the result is received
 
 	// Device (optional)
 	Device CreateDevice `json:"device,omitempty"`
-
-	// TestServer
-	// TestServer CreateTestServer `json:"test_server,omitempty"`
 }
 
 type CreateSpeedTestResultResponse struct {
-	Error    string `json:"error,omitempty"`
-	Message  string `json:"message,omitempty"`
-	DeviceID string `json:"device,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Message      string `json:"message,omitempty"`
+	DeviceID     string `json:"device,omitempty"`
+	DeviceSecret string `json:"device_secret,omitempty"` // only returned when the device is created
+	ID           string `json:"id,omitempty"`
+	Replayed     bool   `json:"replayed,omitempty"` // true when the result was stored by an earlier request
+}
+
+// BatchItemStatus is the outcome of a single result of a batch submission
+type BatchItemStatus struct {
+	Index        int          `json:"index"`  // position of the result in the request
+	Status       ApiStatus    `json:"status"` // "success", "fail" or "error"
+	ID           string       `json:"id,omitempty"`
+	DeviceID     string       `json:"device_id,omitempty"`
+	DeviceSecret string       `json:"device_secret,omitempty"` // only returned for the result whose device was created
+	Replayed     bool         `json:"replayed,omitempty"`      // true when the result was stored by an earlier request
+	Code         string       `json:"code,omitempty"`
+	Message      string       `json:"message,omitempty"`
+	Errors       []FieldError `json:"errors,omitempty"`
+}
+
+type CreateSpeedTestResultsBatchResponse struct {
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Results []BatchItemStatus `json:"results"`
 }
 
 type SpeedTestResults struct {
-	ID string `json:"id"`
+	ID             string  `json:"id"`
+	IdempotencyKey *string `json:"-"` // Idempotency-Key header or client generated id, unique per device
 
 	// Download
 	DownloadSpeed    int `json:"download_speed"`     // average | kbps
@@ -82,14 +110,13 @@ type SpeedTestResults struct {
 	UploadLatency   int `json:"upload_latency"`          // ms
 
 	// Device and Server
-	DeviceID         string `json:"device_id"`
-	ISP              string `json:"isp"`
-	ISPCode          string `json:"isp_code"`
-	ConnectionType   string `json:"connection_type"`
-	ConnectionDevice string `json:"connection_device"`
-	TestPlatform     string `json:"test_platform"`
-	// ServerID         string `json:"server_id"`
-	ServerName       string `json:"server_name"`
+	DeviceID         string  `json:"device_id"`
+	ISP              string  `json:"isp"`
+	ISPCode          string  `json:"isp_code"`
+	ConnectionType   string  `json:"connection_type"`
+	ConnectionDevice string  `json:"connection_device"`
+	TestPlatform     string  `json:"test_platform"`
+	TestServerID     *string `json:"test_server_id"`
 
 	// Location
 	State          string  `json:"state"`
@@ -107,6 +134,39 @@ type SpeedTestResults struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// PublicSpeedTestResult is the sanitized view of a result served by public and partner
+// endpoints, the device id is left out. Admins get the raw SpeedTestResults.
+type PublicSpeedTestResult struct {
+	SpeedTestResults
+	DeviceID string `json:"device_id,omitempty"` // shadows SpeedTestResults.DeviceID, always empty
+}
+
+// PublicSpeedTestResults returns the sanitized view of results
+func PublicSpeedTestResults(results []SpeedTestResults) []PublicSpeedTestResult {
+	public := make([]PublicSpeedTestResult, len(results))
+	for i, r := range results {
+		public[i] = PublicSpeedTestResult{SpeedTestResults: r}
+	}
+	return public
+}
+
+// MetricStats summarises the distribution of a single speed test metric
+type MetricStats struct {
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P10    float64 `json:"p10"`
+	P90    float64 `json:"p90"`
+	Max    float64 `json:"max"`
+}
+
+// SpeedTestResultStats holds the aggregated metrics of the results in a group
+type SpeedTestResultStats struct {
+	Group         string      `json:"group"`
+	Count         int64       `json:"count"`
+	DownloadSpeed MetricStats `json:"download_speed"` // kbps
+	UploadSpeed   MetricStats `json:"upload_speed"`   // kbps
+	Latency       MetricStats `json:"latency"`        // ms
+}
 
 type SpeedtestResultsOld struct {
 	ID string `json:"id"`
@@ -146,10 +206,10 @@ type SpeedtestResultsOld struct {
 	ServerLocation string  `json:"server_location" db:"server_location"`
 	ServerName     string  `json:"server_name" db:"server_name"`
 	// ServerID       string  `json:"server_id" db:"server_id"`
-	LocationAccess bool    `json:"location_access" db:"location_access"`
+	LocationAccess bool `json:"location_access" db:"location_access"`
 	// there should be another field to indicate how accurate
 
 	CreatedAt time.Time `json:"created_at" db:"created_at"` // time when record is created
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"` // time when record is created
 	TestTime  time.Time `json:"test_time" db:"test_time"`   // time when the internet test was taken
-}
\ No newline at end of file
+}
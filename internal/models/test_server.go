@@ -7,11 +7,25 @@ import (
 )
 
 type CreateTestServer struct {
-	ID         string `json:"-"`
-	Identifier string `json:"identifier"`
-	Name       string `json:"name"`
-	City       string `json:"city"`
-	Country    string `json:"country"`
+	ID         string   `json:"-"`
+	Identifier string   `json:"identifier"`
+	Name       string   `json:"name"`
+	City       string   `json:"city"`
+	Country    string   `json:"country"`
+	URL        string   `json:"url"`
+	Latitude   *float64 `json:"latitude"`
+	Longitude  *float64 `json:"longitude"`
+}
+
+// UpdateTestServer holds the test server fields to change, nil fields are left as they are
+type UpdateTestServer struct {
+	Name      *string  `json:"name"`
+	City      *string  `json:"city"`
+	Country   *string  `json:"country"`
+	URL       *string  `json:"url"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	IsActive  *bool    `json:"is_active"`
 }
 
 type TestServer struct {
@@ -20,7 +34,17 @@ type TestServer struct {
 	Name       string         `json:"name"`
 	City       string         `json:"city"`
 	Country    string         `json:"country"`
+	URL        string         `json:"url"`
+	Latitude   *float64       `json:"latitude"`
+	Longitude  *float64       `json:"longitude"`
+	IsActive   bool           `json:"is_active" gorm:"default:true"` // inactive servers are not offered to clients
 	CreatedAt  time.Time      `json:"created_at"`
 	UpdatedAt  time.Time      `json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `json:"deleted_at"`
 }
+
+// NearestTestServer is a test server with its distance from a client
+type NearestTestServer struct {
+	TestServer
+	DistanceKm float64 `json:"distance_km"`
+}
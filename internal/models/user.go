@@ -6,17 +6,44 @@ import (
 	"gorm.io/gorm"
 )
 
+// Roles of a user
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin" // can view raw results and manage results, test servers and API keys
+)
+
 type CreateUser struct {
-	ID        string         `json:"id,omitempty"`
-	Username  string         `json:"username,omitempty"`
-	Email     string         `json:"email,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type LoginUser struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LinkDevice struct {
+	DeviceID     string `json:"device_id"`
+	DeviceSecret string `json:"device_secret"` // issued when the device was created
 }
 
 type User struct {
-	ID        string         `json:"id"`
-	Username  string         `json:"username"`
-	Email     string         `json:"email"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"deleted_at"`
+	ID           string         `json:"id"`
+	Username     string         `json:"username"`
+	Email        string         `json:"email"`
+	PasswordHash string         `json:"-"`
+	Role         string         `json:"role" gorm:"default:user"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"deleted_at"`
+}
+
+// AuthToken is returned on login, the access token is sent back as a bearer token
+type AuthToken struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	User        *User     `json:"user"`
 }
@@ -0,0 +1,67 @@
+package telemetry
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "telemetry:span"
+
+// RegisterGORM adds callbacks to db recording a span for every query, as a child of the span in
+// the context passed to WithContext
+func RegisterGORM(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("telemetry:before_create", startSpan("create")),
+		cb.Create().After("gorm:create").Register("telemetry:after_create", endSpan),
+		cb.Query().Before("gorm:query").Register("telemetry:before_query", startSpan("query")),
+		cb.Query().After("gorm:query").Register("telemetry:after_query", endSpan),
+		cb.Update().Before("gorm:update").Register("telemetry:before_update", startSpan("update")),
+		cb.Update().After("gorm:update").Register("telemetry:after_update", endSpan),
+		cb.Delete().Before("gorm:delete").Register("telemetry:before_delete", startSpan("delete")),
+		cb.Delete().After("gorm:delete").Register("telemetry:after_delete", endSpan),
+		cb.Row().Before("gorm:row").Register("telemetry:before_row", startSpan("row")),
+		cb.Row().After("gorm:row").Register("telemetry:after_row", endSpan),
+		cb.Raw().Before("gorm:raw").Register("telemetry:before_raw", startSpan("raw")),
+		cb.Raw().After("gorm:raw").Register("telemetry:after_raw", endSpan),
+	)
+}
+
+func startSpan(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx, span := Tracer().Start(db.Statement.Context, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation)))
+		db.Statement.Context = ctx
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBCollectionName(db.Statement.Table))
+	}
+	// the statement holds placeholders, the values are not recorded
+	span.SetAttributes(semconv.DBQueryText(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected))
+
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
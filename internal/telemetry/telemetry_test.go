@@ -0,0 +1,75 @@
+package telemetry_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	otelbaggage "go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/checkspeed/sc-backend/internal/config"
+	"github.com/checkspeed/sc-backend/internal/telemetry"
+)
+
+func TestSetup(t *testing.T) {
+	t.Run("none exporter", func(t *testing.T) {
+		shutdown, err := telemetry.Setup(context.Background(), config.Config{TracingExporter: config.TracingExporterNone})
+		require.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("stdout exporter", func(t *testing.T) {
+		shutdown, err := telemetry.Setup(context.Background(),
+			config.Config{TracingExporter: config.TracingExporterStdout, TracingSampleRatio: 1})
+		require.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+}
+
+func TestTransport(t *testing.T) {
+	_, err := telemetry.Setup(context.Background(), config.Config{TracingExporter: config.TracingExporterNone})
+	require.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer provider.Shutdown(context.Background())
+
+	var traceparent, baggage string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		baggage = r.Header.Get("baggage")
+	}))
+	defer upstream.Close()
+
+	member, err := otelbaggage.NewMember("user_id", "user-1")
+	require.NoError(t, err)
+	bag, err := otelbaggage.New(member)
+	require.NoError(t, err)
+
+	ctx, span := telemetry.Tracer().Start(otelbaggage.ContextWithBaggage(context.Background(), bag), "handler")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+"/ipgeo?apiKey=secret", nil)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: telemetry.Transport(nil)}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	span.End()
+
+	assert.Empty(t, traceparent, "trace context is not sent upstream")
+	assert.Empty(t, baggage, "baggage is not sent upstream")
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, span.SpanContext().SpanID(), spans[0].Parent().SpanID(), "upstream span is a child of the handler span")
+	assert.Equal(t, "GET "+strings.TrimPrefix(upstream.URL, "http://"), spans[0].Name())
+	for _, attr := range spans[0].Attributes() {
+		assert.NotContains(t, attr.Value.Emit(), "secret", "the url is not recorded")
+	}
+}
@@ -0,0 +1,25 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistanceKm(t *testing.T) {
+	// Lagos to Nairobi is about 3,820 km
+	assert.InDelta(t, 3820, utils.DistanceKm(6.5244, 3.3792, -1.2921, 36.8219), 20)
+	// London to New York is about 5,570 km
+	assert.InDelta(t, 5570, utils.DistanceKm(51.5074, -0.1278, 40.7128, -74.0060), 20)
+	assert.Equal(t, float64(0), utils.DistanceKm(6.5, 3.3, 6.5, 3.3))
+	// antipodal points are half the circumference apart
+	assert.InDelta(t, 20015, utils.DistanceKm(0, 0, 0, 180), 1)
+}
+
+func TestIsValidCoordinate(t *testing.T) {
+	assert.True(t, utils.IsValidCoordinate(6.5, 3.3))
+	assert.True(t, utils.IsValidCoordinate(-90, 180))
+	assert.False(t, utils.IsValidCoordinate(91, 0))
+	assert.False(t, utils.IsValidCoordinate(0, -181))
+}
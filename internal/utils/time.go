@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// MaxClockSkew is how far in the future a client reported time may be
+// before it is rejected, to allow for clocks that are slightly ahead
+const MaxClockSkew = 5 * time.Minute
+
+var (
+	ErrInvalidTime = errors.New("invalid time format")
+	ErrFutureTime  = errors.New("time is in the future")
+	ErrExpiredTime = errors.New("time is too old")
+	ErrTimeZone    = errors.New("time zone must be UTC, GMT or a numeric offset")
+)
+
+// ParseTime parses value with the first of layouts that matches and returns it in UTC. Zone
+// abbreviations other than UTC and GMT are rejected: Go reads unknown ones such as PST as UTC,
+// which would shift the time by the zone's offset.
+func ParseTime(value string, layouts ...string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(layout, "MST") {
+			if zone, _ := t.Zone(); zone != "UTC" && zone != "GMT" {
+				return time.Time{}, ErrTimeZone
+			}
+		}
+		return t.UTC(), nil
+	}
+	return time.Time{}, ErrInvalidTime
+}
+
+// CheckTimeWindow returns an error if t is ahead of now by more than MaxClockSkew
+// or older than maxAge. A zero maxAge disables the age check.
+func CheckTimeWindow(t, now time.Time, maxAge time.Duration) error {
+	if t.After(now.Add(MaxClockSkew)) {
+		return ErrFutureTime
+	}
+	if maxAge > 0 && t.Before(now.Add(-maxAge)) {
+		return ErrExpiredTime
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/checkspeed/sc-backend/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTime(t *testing.T) {
+	layouts := []string{time.RFC3339, time.RFC1123, time.RFC1123Z}
+	expected := time.Date(2024, 7, 8, 21, 46, 42, 0, time.UTC)
+
+	testCases := []struct {
+		name  string
+		value string
+	}{
+		{name: "RFC3339 utc", value: "2024-07-08T21:46:42Z"},
+		{name: "RFC3339 with offset", value: "2024-07-08T22:46:42+01:00"},
+		{name: "RFC1123", value: "Mon, 08 Jul 2024 21:46:42 GMT"},
+		{name: "RFC1123Z", value: "Mon, 08 Jul 2024 23:46:42 +0200"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed, err := utils.ParseTime(tc.value, layouts...)
+			require.NoError(t, err)
+			assert.True(t, expected.Equal(parsed))
+			assert.Equal(t, time.UTC, parsed.Location())
+		})
+	}
+
+	t.Run("fractional seconds", func(t *testing.T) {
+		parsed, err := utils.ParseTime("2024-07-08T21:46:42.279Z", layouts...)
+		require.NoError(t, err)
+		assert.Equal(t, 279*time.Millisecond, parsed.Sub(expected))
+	})
+
+	t.Run("named time zone", func(t *testing.T) {
+		for _, value := range []string{"Mon, 08 Jul 2024 13:46:42 PST", "Mon, 08 Jul 2024 23:46:42 CEST"} {
+			_, err := utils.ParseTime(value, layouts...)
+			assert.ErrorIs(t, err, utils.ErrTimeZone, value)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := utils.ParseTime("08/07/2024 21:46", layouts...)
+		assert.ErrorIs(t, err, utils.ErrInvalidTime)
+	})
+}
+
+func TestCheckTimeWindow(t *testing.T) {
+	now := time.Date(2024, 7, 8, 12, 0, 0, 0, time.UTC)
+	maxAge := 24 * time.Hour
+
+	assert.NoError(t, utils.CheckTimeWindow(now.Add(-time.Hour), now, maxAge))
+	assert.NoError(t, utils.CheckTimeWindow(now.Add(time.Minute), now, maxAge))
+	assert.ErrorIs(t, utils.CheckTimeWindow(now.Add(time.Hour), now, maxAge), utils.ErrFutureTime)
+	assert.ErrorIs(t, utils.CheckTimeWindow(now.Add(-48*time.Hour), now, maxAge), utils.ErrExpiredTime)
+	assert.NoError(t, utils.CheckTimeWindow(now.Add(-48*time.Hour), now, 0))
+}
@@ -0,0 +1,26 @@
+package validation
+
+import "github.com/checkspeed/sc-backend/internal/models"
+
+// ValidateUpdateDevice checks that the device metadata fits the devices columns
+func ValidateUpdateDevice(input models.UpdateDevice) Errors {
+	var errs Errors
+
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"os", input.OS},
+		{"device_type", input.DeviceType},
+		{"manufacturer", input.Manufacturer},
+		{"model", input.Model},
+		{"screen_resolution", input.ScreenResolution},
+	}
+	for _, f := range fields {
+		if f.value != nil {
+			errs.checkLength(f.name, *f.value, 50)
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,62 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+// Machine-readable codes of field errors
+const (
+	CodeRequired     = "REQUIRED"
+	CodeOutOfRange   = "OUT_OF_RANGE"
+	CodeInvalidValue = "INVALID_VALUE"
+	CodeMinAboveMax  = "MIN_ABOVE_MAX"
+	CodeTooLong      = "TOO_LONG"
+)
+
+const maxInt = int(^uint(0) >> 1)
+
+// Errors holds the validation errors of a request, it is empty when the request is valid
+type Errors []models.FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// HasField reports whether there is an error for field
+func (e Errors) HasField(field string) bool {
+	for _, fe := range e {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Errors) add(field, code, message string) {
+	*e = append(*e, models.FieldError{Field: field, Code: code, Message: message})
+}
+
+// checkRange checks min <= value <= max, a min above 0 makes the field required
+func (e *Errors) checkRange(field string, value, min, max int) {
+	if value == 0 && min > 0 {
+		e.add(field, CodeRequired, field+" is required")
+		return
+	}
+	if value < min || value > max {
+		e.add(field, CodeOutOfRange, fmt.Sprintf("%s must be between %d and %d", field, min, max))
+	}
+}
+
+func (e *Errors) checkLength(field, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		e.add(field, CodeTooLong, fmt.Sprintf("%s must not be longer than %d characters", field, max))
+	}
+}
@@ -0,0 +1,134 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+)
+
+const (
+	MaxSpeed   = 10_000_000 // kbps, 10 Gbps
+	MaxLatency = 60_000     // ms
+)
+
+// ConnectionTypes are the accepted values of connection_type, compared case insensitively
+var ConnectionTypes = map[string]bool{
+	"wifi":      true,
+	"wi-fi":     true,
+	"ethernet":  true,
+	"cellular":  true,
+	"2g":        true,
+	"3g":        true,
+	"4g":        true,
+	"lte":       true,
+	"5g":        true,
+	"dsl":       true,
+	"cable":     true,
+	"fiber":     true,
+	"satellite": true,
+	"wireless":  true,
+	"unknown":   true,
+}
+
+// ValidateSpeedTestResult checks that every field of input holds a plausible value
+// and returns an error for each one that does not
+func ValidateSpeedTestResult(input models.CreateSpeedTestResult) Errors {
+	var errs Errors
+
+	if input.ID != "" {
+		if _, err := uuid.Parse(input.ID); err != nil {
+			errs.add("id", CodeInvalidValue, "id must be a uuid")
+		}
+	}
+	if input.TestServerID != "" {
+		if _, err := uuid.Parse(input.TestServerID); err != nil {
+			errs.add("test_server_id", CodeInvalidValue, "test_server_id must be a uuid")
+		}
+	}
+	errs.checkLength("test_server_identifier", input.TestServerIdentifier, 100)
+
+	// download
+	errs.checkRange("download_speed", input.DownloadSpeed, 1, MaxSpeed)
+	errs.checkRange("max_download_speed", input.MaxDownloadSpeed, 0, MaxSpeed)
+	errs.checkRange("min_download_speed", input.MinDownloadSpeed, 0, MaxSpeed)
+	errs.checkRange("total_download", input.TotalDownload, 0, maxInt)
+	errs.checkMinMax("download_speed", input.DownloadSpeed, input.MinDownloadSpeed, input.MaxDownloadSpeed)
+
+	// upload
+	errs.checkRange("upload_speed", input.UploadSpeed, 0, MaxSpeed)
+	errs.checkRange("max_upload_speed", input.MaxUploadSpeed, 0, MaxSpeed)
+	errs.checkRange("min_upload_speed", input.MinUploadSpeed, 0, MaxSpeed)
+	errs.checkRange("total_upload", input.TotalUpload, 0, maxInt)
+	errs.checkMinMax("upload_speed", input.UploadSpeed, input.MinUploadSpeed, input.MaxUploadSpeed)
+
+	// latency
+	errs.checkRange("latency", input.Latency, 1, MaxLatency)
+	errs.checkRange("loaded_latency", input.LoadedLatency, 0, MaxLatency)
+	errs.checkRange("unloaded_latency", input.UnloadedLatency, 0, MaxLatency)
+	errs.checkRange("download_latency", input.DownloadLatency, 0, MaxLatency)
+	errs.checkRange("upload_latency", input.UploadLatency, 0, MaxLatency)
+
+	// location
+	if input.Latitude < -90 || input.Latitude > 90 {
+		errs.add("latitude", CodeOutOfRange, "latitude must be between -90 and 90")
+	}
+	if input.Longitude < -180 || input.Longitude > 180 {
+		errs.add("longitude", CodeOutOfRange, "longitude must be between -180 and 180")
+	}
+	if input.CountryCode != "" && !isLetters(input.CountryCode, 2, 3) {
+		errs.add("country_code", CodeInvalidValue, "country_code must be a 2 or 3 letter code")
+	}
+	if input.ContinentCode != "" && !isLetters(input.ContinentCode, 2, 2) {
+		errs.add("continent_code", CodeInvalidValue, "continent_code must be a 2 letter code")
+	}
+
+	if input.ConnectionType != "" && !ConnectionTypes[strings.ToLower(input.ConnectionType)] {
+		errs.add("connection_type", CodeInvalidValue, fmt.Sprintf("unknown connection_type %q", input.ConnectionType))
+	}
+
+	// lengths of the speed_test_results columns
+	errs.checkLength("isp", input.ISP, 50)
+	errs.checkLength("isp_code", input.ISPCode, 15)
+	errs.checkLength("connection_type", input.ConnectionType, 50)
+	errs.checkLength("connection_device", input.ConnectionDevice, 50)
+	errs.checkLength("test_platform", input.TestPlatform, 50)
+	errs.checkLength("server_name", input.ServerName, 50)
+	errs.checkLength("state", input.State, 50)
+	errs.checkLength("country_name", input.CountryName, 50)
+	errs.checkLength("continent_name", input.ContinentName, 50)
+
+	return errs
+}
+
+// checkMinMax checks that min <= avg <= max for a metric, min and max are ignored when not set.
+// Metrics whose values already failed validation are skipped to avoid duplicate errors.
+func (e *Errors) checkMinMax(field string, avg, min, max int) {
+	if e.HasField(field) || e.HasField("min_"+field) || e.HasField("max_"+field) {
+		return
+	}
+	if min > 0 && max > 0 && min > max {
+		e.add("min_"+field, CodeMinAboveMax, fmt.Sprintf("min_%[1]s must not be greater than max_%[1]s", field))
+		return
+	}
+	if min > 0 && avg < min {
+		e.add(field, CodeOutOfRange, fmt.Sprintf("%[1]s must not be less than min_%[1]s", field))
+	}
+	if max > 0 && avg > max {
+		e.add(field, CodeOutOfRange, fmt.Sprintf("%[1]s must not be greater than max_%[1]s", field))
+	}
+}
+
+func isLetters(s string, minLen, maxLen int) bool {
+	if len(s) < minLen || len(s) > maxLen {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
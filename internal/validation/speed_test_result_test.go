@@ -0,0 +1,144 @@
+package validation_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/checkspeed/sc-backend/internal/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+func validResult() models.CreateSpeedTestResult {
+	return models.CreateSpeedTestResult{
+		DownloadSpeed:    19000,
+		MinDownloadSpeed: 12000,
+		MaxDownloadSpeed: 25000,
+		UploadSpeed:      7200,
+		Latency:          46,
+		LoadedLatency:    58,
+		UnloadedLatency:  34,
+		ISP:              "Starlink Internet Services Nigeria Ltd",
+		ISPCode:          "STARLINK",
+		ConnectionType:   "4G",
+		CountryCode:      "NG",
+		ContinentCode:    "AF",
+		Longitude:        3.38876,
+		Latitude:         6.4547,
+	}
+}
+
+func TestValidateSpeedTestResult(t *testing.T) {
+	t.Run("valid result", func(t *testing.T) {
+		errs := validation.ValidateSpeedTestResult(validResult())
+		assert.Empty(t, errs)
+	})
+
+	testCases := []struct {
+		name   string
+		modify func(r *models.CreateSpeedTestResult)
+		field  string
+		code   string
+	}{
+		{
+			name:   "id is not a uuid",
+			modify: func(r *models.CreateSpeedTestResult) { r.ID = "result-1" },
+			field:  "id",
+			code:   validation.CodeInvalidValue,
+		},
+		{
+			name:   "missing download speed",
+			modify: func(r *models.CreateSpeedTestResult) { r.DownloadSpeed = 0 },
+			field:  "download_speed",
+			code:   validation.CodeRequired,
+		},
+		{
+			name:   "negative upload speed",
+			modify: func(r *models.CreateSpeedTestResult) { r.UploadSpeed = -10 },
+			field:  "upload_speed",
+			code:   validation.CodeOutOfRange,
+		},
+		{
+			name:   "implausible download speed",
+			modify: func(r *models.CreateSpeedTestResult) { r.DownloadSpeed = validation.MaxSpeed + 1 },
+			field:  "download_speed",
+			code:   validation.CodeOutOfRange,
+		},
+		{
+			name:   "zero latency",
+			modify: func(r *models.CreateSpeedTestResult) { r.Latency = 0 },
+			field:  "latency",
+			code:   validation.CodeRequired,
+		},
+		{
+			name: "min above max",
+			modify: func(r *models.CreateSpeedTestResult) {
+				r.MinDownloadSpeed = 30000
+				r.MaxDownloadSpeed = 20000
+			},
+			field: "min_download_speed",
+			code:  validation.CodeMinAboveMax,
+		},
+		{
+			name:   "average above max",
+			modify: func(r *models.CreateSpeedTestResult) { r.MaxDownloadSpeed = 15000 },
+			field:  "download_speed",
+			code:   validation.CodeOutOfRange,
+		},
+		{
+			name:   "latitude out of range",
+			modify: func(r *models.CreateSpeedTestResult) { r.Latitude = 91 },
+			field:  "latitude",
+			code:   validation.CodeOutOfRange,
+		},
+		{
+			name:   "longitude out of range",
+			modify: func(r *models.CreateSpeedTestResult) { r.Longitude = -180.5 },
+			field:  "longitude",
+			code:   validation.CodeOutOfRange,
+		},
+		{
+			name:   "unknown connection type",
+			modify: func(r *models.CreateSpeedTestResult) { r.ConnectionType = "carrier pigeon" },
+			field:  "connection_type",
+			code:   validation.CodeInvalidValue,
+		},
+		{
+			name:   "invalid country code",
+			modify: func(r *models.CreateSpeedTestResult) { r.CountryCode = "N1" },
+			field:  "country_code",
+			code:   validation.CodeInvalidValue,
+		},
+		{
+			name:   "isp code too long",
+			modify: func(r *models.CreateSpeedTestResult) { r.ISPCode = strings.Repeat("A", 16) },
+			field:  "isp_code",
+			code:   validation.CodeTooLong,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := validResult()
+			tc.modify(&input)
+
+			errs := validation.ValidateSpeedTestResult(input)
+			assert.Len(t, errs, 1)
+			assert.True(t, errs.HasField(tc.field))
+			assert.Equal(t, tc.code, errs[0].Code)
+		})
+	}
+
+	t.Run("reports every invalid field", func(t *testing.T) {
+		input := validResult()
+		input.DownloadSpeed = -1
+		input.Latency = -1
+		input.Latitude = -100
+
+		errs := validation.ValidateSpeedTestResult(input)
+		assert.Len(t, errs, 3)
+		assert.True(t, errs.HasField("download_speed"))
+		assert.True(t, errs.HasField("latency"))
+		assert.True(t, errs.HasField("latitude"))
+	})
+}
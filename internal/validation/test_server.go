@@ -0,0 +1,39 @@
+package validation
+
+import "github.com/checkspeed/sc-backend/internal/models"
+
+// ValidateCreateTestServer checks that the test server fields fit the test_servers columns
+func ValidateCreateTestServer(input models.CreateTestServer) Errors {
+	var errs Errors
+
+	errs.checkLength("identifier", input.Identifier, 100)
+	errs.checkLength("name", input.Name, 100)
+	errs.checkLength("city", input.City, 100)
+	errs.checkLength("country", input.Country, 100)
+	errs.checkLength("url", input.URL, 255)
+
+	return errs
+}
+
+// ValidateUpdateTestServer checks that the changed test server fields fit the test_servers columns
+func ValidateUpdateTestServer(input models.UpdateTestServer) Errors {
+	var errs Errors
+
+	fields := []struct {
+		name  string
+		value *string
+		max   int
+	}{
+		{"name", input.Name, 100},
+		{"city", input.City, 100},
+		{"country", input.Country, 100},
+		{"url", input.URL, 255},
+	}
+	for _, f := range fields {
+		if f.value != nil {
+			errs.checkLength(f.name, *f.value, f.max)
+		}
+	}
+
+	return errs
+}
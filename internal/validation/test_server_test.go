@@ -0,0 +1,34 @@
+package validation_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/checkspeed/sc-backend/internal/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCreateTestServer(t *testing.T) {
+	valid := models.CreateTestServer{Identifier: "lagos-1", Name: "Lagos 1", City: "Lagos", Country: "NG", URL: "https://lagos-1.example.com"}
+	assert.Empty(t, validation.ValidateCreateTestServer(valid))
+
+	long := valid
+	long.Identifier = strings.Repeat("a", 101)
+	long.URL = "https://" + strings.Repeat("a", 250)
+	errs := validation.ValidateCreateTestServer(long)
+	assert.Len(t, errs, 2)
+	assert.True(t, errs.HasField("identifier"))
+	assert.True(t, errs.HasField("url"))
+	assert.Equal(t, validation.CodeTooLong, errs[0].Code)
+}
+
+func TestValidateUpdateTestServer(t *testing.T) {
+	name := "Lagos 1"
+	assert.Empty(t, validation.ValidateUpdateTestServer(models.UpdateTestServer{Name: &name}))
+
+	city := strings.Repeat("a", 101)
+	errs := validation.ValidateUpdateTestServer(models.UpdateTestServer{Name: &name, City: &city})
+	assert.Len(t, errs, 1)
+	assert.True(t, errs.HasField("city"))
+}
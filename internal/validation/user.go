@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/checkspeed/sc-backend/internal/utils"
+)
+
+// Password length bounds, bcrypt ignores everything past 72 bytes
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// ValidateCreateUser checks the registration details of a new user
+func ValidateCreateUser(input models.CreateUser) Errors {
+	var errs Errors
+
+	username := strings.TrimSpace(input.Username)
+	switch {
+	case username == "":
+		errs.add("username", CodeRequired, "username is required")
+	case utf8.RuneCountInString(username) < 3:
+		errs.add("username", CodeInvalidValue, "username must be at least 3 characters")
+	default:
+		errs.checkLength("username", username, 50)
+	}
+
+	email := strings.TrimSpace(input.Email)
+	switch {
+	case email == "":
+		errs.add("email", CodeRequired, "email is required")
+	case !utils.IsValidEmail(email):
+		errs.add("email", CodeInvalidValue, "email must be a valid email address")
+	default:
+		errs.checkLength("email", email, 100)
+	}
+
+	switch {
+	case input.Password == "":
+		errs.add("password", CodeRequired, "password is required")
+	case utf8.RuneCountInString(input.Password) < MinPasswordLength:
+		errs.add("password", CodeInvalidValue, "password must be at least 8 characters")
+	case len(input.Password) > MaxPasswordLength:
+		errs.add("password", CodeTooLong, "password must not be longer than 72 bytes")
+	}
+
+	return errs
+}
@@ -0,0 +1,68 @@
+package validation_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/checkspeed/sc-backend/internal/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCreateUser(t *testing.T) {
+	valid := models.CreateUser{Username: "ada", Email: "ada@example.com", Password: "correct horse"}
+
+	t.Run("valid user", func(t *testing.T) {
+		assert.Empty(t, validation.ValidateCreateUser(valid))
+	})
+
+	testCases := []struct {
+		name   string
+		modify func(u *models.CreateUser)
+		field  string
+		code   string
+	}{
+		{
+			name:   "missing username",
+			modify: func(u *models.CreateUser) { u.Username = " " },
+			field:  "username",
+			code:   validation.CodeRequired,
+		},
+		{
+			name:   "username too long",
+			modify: func(u *models.CreateUser) { u.Username = strings.Repeat("a", 51) },
+			field:  "username",
+			code:   validation.CodeTooLong,
+		},
+		{
+			name:   "invalid email",
+			modify: func(u *models.CreateUser) { u.Email = "ada.example.com" },
+			field:  "email",
+			code:   validation.CodeInvalidValue,
+		},
+		{
+			name:   "short password",
+			modify: func(u *models.CreateUser) { u.Password = "secret" },
+			field:  "password",
+			code:   validation.CodeInvalidValue,
+		},
+		{
+			name:   "password too long",
+			modify: func(u *models.CreateUser) { u.Password = strings.Repeat("p", validation.MaxPasswordLength+1) },
+			field:  "password",
+			code:   validation.CodeTooLong,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := valid
+			tc.modify(&input)
+
+			errs := validation.ValidateCreateUser(input)
+			assert.Len(t, errs, 1)
+			assert.True(t, errs.HasField(tc.field))
+			assert.Equal(t, tc.code, errs[0].Code)
+		})
+	}
+}
@@ -2,79 +2,296 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/checkspeed/sc-backend/internal/config"
 	"github.com/checkspeed/sc-backend/internal/controllers"
 	"github.com/checkspeed/sc-backend/internal/db"
+	"github.com/checkspeed/sc-backend/internal/logger"
+	"github.com/checkspeed/sc-backend/internal/metrics"
 	"github.com/checkspeed/sc-backend/internal/middleware"
+	"github.com/checkspeed/sc-backend/internal/models"
+	"github.com/checkspeed/sc-backend/internal/telemetry"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
 	cfg := config.LoadConfig()
+	slog.SetDefault(logger.New(cfg))
 
 	// init db
 	store, err := db.NewStore(cfg.DBURL)
 	if err != nil {
-		log.Fatalf("unable to initialize database, %v \n", err.Error())
+		fatal("unable to initialize database", err)
+	}
+
+	if len(os.Args) > 1 {
+		err := runCommand(context.Background(), cfg, store, os.Args[1:])
+		store.CloseConn(context.Background())
+		if err != nil {
+			fatal(os.Args[1]+" failed", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := telemetry.Setup(context.Background(), cfg)
+	if err != nil {
+		fatal("unable to initialize tracing", err)
 	}
 
 	ctrl, err := controllers.NewController(cfg, store)
 	if err != nil {
-		log.Fatalf("unable to initialize controller, %v \n", err.Error())
+		fatal("unable to initialize controller", err)
 	}
 
-	// Initialize rate limiter
-	clientLimiter := middleware.NewClientLimiter()
+	// Initialize rate limiters
+	newLimiterStore := func() middleware.LimiterStore {
+		return middleware.NewMemoryLimiterStore(cfg.RateLimits.MaxEntries)
+	}
+	var sharedStore middleware.LimiterStore
+	if cfg.RateLimits.Backend == config.RateLimitBackendPostgres {
+		buckets, err := db.NewRateLimitBucketsRepo(store)
+		if err != nil {
+			fatal("unable to initialize rate limit buckets", err)
+		}
+		sharedStore = middleware.NewSharedLimiterStore(buckets)
+		newLimiterStore = func() middleware.LimiterStore { return sharedStore }
+	}
+	limiters := middleware.NewRouteLimiters(cfg.RateLimits, newLimiterStore)
+	keyLimiter := middleware.NewKeyLimiter(newLimiterStore())
+	if err := keyLimiter.RegisterMetrics(); err != nil {
+		fatal("unable to register rate limiter metrics", err)
+	}
+	for _, clientLimiter := range limiters.All() {
+		if err := clientLimiter.RegisterMetrics(); err != nil {
+			fatal("unable to register rate limiter metrics", err)
+		}
+	}
 
-	// Start cleanup routine for rate limiter
-	go func() {
-		for {
-			time.Sleep(10 * time.Minute) // Cleanup every 10 minutes
-			clientLimiter.CleanupStaleIPs()
+	// Start cleanup routines for rate limiters and the geolocation cache, and the geolocation
+	// database reload, they stop when the application closes
+	limitersCtx, stopLimiters := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	var runners []func(context.Context)
+	if sharedStore != nil {
+		// all the limiters share the store, it is cleaned up once
+		runners = append(runners, func(ctx context.Context) {
+			middleware.RunCleanup(ctx, "shared", sharedStore, cfg.RateLimits.CleanupInterval)
+		})
+	} else {
+		runners = append(runners, keyLimiter.Run)
+		for _, clientLimiter := range limiters.All() {
+			runners = append(runners, clientLimiter.Run)
 		}
-	}()
+	}
+	if localGeo := ctrl.LocalGeo(); localGeo != nil {
+		runners = append(runners, localGeo.Run)
+	}
+	if geoCache := ctrl.GeoCache(); geoCache != nil {
+		runners = append(runners, geoCache.Run)
+	}
+	for _, run := range runners {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run(limitersCtx)
+		}()
+	}
 
-	// create channel to listen to shutdown signals
-	shutdownChan := make(chan os.Signal, 1)
-	signal.Notify(shutdownChan, syscall.SIGTERM, syscall.SIGINT)
+	router, err := NewRouter(cfg, ctrl, limiters, keyLimiter)
+	if err != nil {
+		fatal("unable to initialize router", err)
+	}
 
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// metrics are served on their own port, which is left out of the public ingress
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", metrics.Handler())
+	metricsSrv := &http.Server{
+		Addr:              ":" + cfg.MetricsPort,
+		Handler:           metricsMux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// listen to shutdown signals
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stopSignals()
+
+	serverErr := make(chan error, 2)
+	go func() {
+		slog.Info("listening", "addr", srv.Addr)
+		serverErr <- srv.ListenAndServe()
+	}()
 	go func() {
-		RunServer(ctrl, cfg, clientLimiter)
+		slog.Info("serving metrics", "addr", metricsSrv.Addr)
+		serverErr <- metricsSrv.ListenAndServe()
 	}()
 
-	<-shutdownChan
-	log.Println("Closing application")
-	store.CloseConn(context.Background())
+	// the process exits with an error when the server stopped on its own, e.g. the port is taken
+	exitCode := 0
+	select {
+	case err := <-serverErr:
+		slog.Error("server stopped", "error", err)
+		exitCode = 1
+	case <-signalCtx.Done():
+		slog.Info("closing application")
+	}
+	stopSignals() // a second signal kills the application right away
+
+	// fail readiness first and give the orchestrator time to notice before requests are refused
+	ctrl.SetDraining()
+	if cfg.ShutdownDelay > 0 {
+		slog.Info("draining before shutting down", "delay", cfg.ShutdownDelay)
+		time.Sleep(cfg.ShutdownDelay)
+	}
+
+	// stop accepting requests and let the in flight ones finish, e.g. submissions being stored
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server did not drain in time", "timeout", cfg.ShutdownTimeout, "error", err)
+	}
+	// the metrics stay available until the requests are drained
+	if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to stop the metrics server", "error", err)
+	}
+
+	// the store is closed last, once nothing uses it anymore
+	stopLimiters()
+	background.Wait()
+	if localGeo := ctrl.LocalGeo(); localGeo != nil {
+		if err := localGeo.Close(); err != nil {
+			slog.Error("failed to close geolocation database", "error", err)
+		}
+	}
+	if err := store.CloseConn(context.Background()); err != nil {
+		slog.Error("failed to close database connection", "error", err)
+	}
+	// flush the spans of the last requests
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	slog.Info("application closed")
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// fatal logs that the application cannot start because of err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
-func RunServer(ctrl *controllers.Controller, cfg config.Config, clientLimiter *middleware.ClientLimiter) {
-	r := gin.Default()
+// NewRouter returns the handler of all the routes of the API
+func NewRouter(cfg config.Config, ctrl *controllers.Controller, limiters *middleware.RouteLimiters,
+	keyLimiter *middleware.KeyLimiter) (*gin.Engine, error) {
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// the client address used by the rate limits and geolocation is only taken from
+	// X-Forwarded-For when the request comes from a trusted proxy
+	trustedProxies := make([]string, 0, len(cfg.TrustedProxies))
+	for _, prefix := range cfg.TrustedProxies {
+		trustedProxies = append(trustedProxies, prefix.String())
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, err
+	}
 
 	// add cors config
 	corsConfig := cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowOrigins: []string{"*"},
+		AllowMethods: []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", middleware.APIKeyHeader,
+			middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", middleware.RequestIDHeader},
 		AllowCredentials: false,
 	}
 	r.Use(cors.New(corsConfig))
+	r.Use(otelgin.Middleware(telemetry.ServiceName, otelgin.WithFilter(notProbe)))
+	r.Use(middleware.RequestLogger(slog.Default()))
+	r.Use(metrics.Middleware())
 
 	r.GET("/", welcome)
-	r.GET("/network", ctrl.GetNetworkInfo)
-	r.GET("/geolocation", ctrl.GetNetworkInfo)
-	r.POST("/speed_test_result", middleware.RateLimit(clientLimiter), ctrl.CreateSpeedtestResults)
+	r.GET("/healthz", ctrl.Healthz)
+	r.GET("/readyz", ctrl.Readyz)
+	r.GET("/v2/network", middleware.RateLimit(limiters.Network), ctrl.GetNetworkInfo)
+	// deprecated, they answer in the format of the previous release until the next one
+	r.GET("/network", middleware.RateLimit(limiters.Network), ctrl.GetNetworkInfoLegacy)
+	r.GET("/geolocation", middleware.RateLimit(limiters.Network), ctrl.GetNetworkInfoLegacy)
+	r.POST("/speed_test_result", middleware.RateLimit(limiters.Submit), middleware.OptionalAuth(ctrl.Tokens()),
+		ctrl.CreateSpeedtestResults)
+	r.POST("/speed_test_result/batch", middleware.RateLimit(limiters.Submit), middleware.OptionalAuth(ctrl.Tokens()),
+		ctrl.CreateSpeedtestResultsBatch)
 	r.POST("/speed_test_result/list", ctrl.GetSpeedtestResults)
-	r.POST("/feedback", ctrl.CreateFeedback)
-	r.Run(":" + cfg.Port)
+	r.POST("/speed_test_result/stats", ctrl.GetSpeedtestResultsStats)
+	r.GET("/isp/leaderboard", ctrl.GetISPLeaderboard)
+	r.POST("/feedback", middleware.RateLimit(limiters.Feedback), ctrl.CreateFeedback)
+
+	// devices linked to a user are only read and changed with the owner's token
+	devices := r.Group("/devices")
+	devices.GET("/:id", middleware.OptionalAuth(ctrl.Tokens()), ctrl.GetDevice)
+	devices.GET("/:id/results", middleware.OptionalAuth(ctrl.Tokens()), ctrl.GetDeviceResults)
+	devices.PATCH("/:id", middleware.OptionalAuth(ctrl.Tokens()), ctrl.UpdateDevice)
+
+	users := r.Group("/users")
+	users.POST("/register", middleware.RateLimit(limiters.Auth), ctrl.RegisterUser)
+	users.POST("/login", middleware.RateLimit(limiters.Auth), ctrl.LoginUser)
+
+	user := users.Group("/:id", middleware.RequireAuth(ctrl.Tokens()), middleware.RequireSameUser("id"))
+	user.GET("/devices", ctrl.ListUserDevices)
+	user.POST("/devices", ctrl.LinkUserDevice)
+	user.GET("/results", ctrl.GetUserResults)
 
+	testServers := r.Group("/test_servers")
+	testServers.GET("", ctrl.ListTestServers)
+	testServers.GET("/nearest", middleware.RateLimit(limiters.Network), ctrl.GetNearestTestServers)
+	testServers.GET("/:id", ctrl.GetTestServer)
+
+	// programmatic access for partners, authenticated by API key
+	partner := r.Group("/partner", middleware.APIKeyAuth(ctrl.APIKeys(), keyLimiter))
+	partner.POST("/speed_test_result/list", ctrl.GetSpeedtestResults)
+	partner.POST("/speed_test_result/stats", ctrl.GetSpeedtestResultsStats)
+
+	admin := r.Group("/admin", middleware.RequireAuth(ctrl.Tokens()), middleware.RequireRole(ctrl.Users(), models.RoleAdmin))
+	admin.POST("/speed_test_result/list", ctrl.AdminGetSpeedtestResults)
+	admin.DELETE("/speed_test_result/:id", ctrl.DeleteSpeedtestResult)
+	admin.GET("/test_servers", ctrl.AdminListTestServers)
+	admin.POST("/test_servers", ctrl.CreateTestServer)
+	admin.PATCH("/test_servers/:id", ctrl.UpdateTestServer)
+	admin.DELETE("/test_servers/:id", ctrl.DeleteTestServer)
+	admin.GET("/feedback", ctrl.ListFeedback)
+	admin.GET("/api_keys", ctrl.ListAPIKeys)
+	admin.POST("/api_keys", ctrl.CreateAPIKey)
+	admin.DELETE("/api_keys/:id", ctrl.RevokeAPIKey)
+
+	return r, nil
+}
+
+// notProbe reports whether r is not a request of the orchestrator or of Prometheus, which are
+// not worth tracing
+func notProbe(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz":
+		return false
+	}
+	return true
 }
 
 func welcome(c *gin.Context) {